@@ -1,11 +1,16 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/babbage88/infra-cli/internal/pretty"
 	"github.com/babbage88/infra-cli/ssh"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -15,99 +20,235 @@ var (
 	cmdToRun       string
 	hostConnMap    = make(map[string]string)
 	configFilePath string
-	mergedHostMap  = make(map[string][]string)
+	cmdTimeout     time.Duration
+	cmdUseSudo     bool
+	cmdOutput      string
+	cmdParallel    int
+	cmdBatchSize   int
+	cmdBatchPause  time.Duration
+	cmdFailFast    bool
+	cmdMaxFailures int
+	cmdScript      string
+	cmdStdinFile   string
+	cmdTarget      string
 )
 
 var clusterSsh = &cobra.Command{
-	Use:     "cluster-ssh",
+	Use:     "cluster-ssh [--cmd <command> | --script <file> [-- args...]]",
 	Aliases: []string{"cssh"},
 	Short:   "Execute SSH commands concurrently across multiple hosts",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		start := time.Now()
+	Long: `Execute SSH commands concurrently across multiple hosts.
 
-		// Step 1: Load config file into mergedHostMap
-		configLoaded := false
-		if configFilePath != "" {
-			if err := loadHostMapFromConfig(configFilePath, mergedHostMap); err != nil {
-				return err
-			}
-			configLoaded = true
-		}
+--cmd is run by the remote shell as a single sh -c string, so pipes, quotes, redirects and &&
+work as they would locally, also with --sudo. --script uploads a local script to each host, runs
+it with the arguments given after -- and removes it afterwards. --stdin-file pipes a local file
+into the command or script on every host.
 
-		// Step 2: Merge flags into mergedHostMap
-		flagProvided := len(hostConnMap) > 0
-		if flagProvided {
-			mergeHostMapFromFlags(hostConnMap, mergedHostMap)
-		}
+--output selects how results are reported: the default prints each host's output followed by a
+summary table, table prints only the summary, json prints one object per host per line, yaml
+prints a list of results, and dir=<path> writes each host's stdout and stderr to
+<path>/<user>@<host>.stdout and .stderr. The exit status is non-zero when any host fails.
 
-		// Step 3: Deduplicate only if both were provided
-		if configLoaded && flagProvided {
-			dedupeHostMap(mergedHostMap)
-		}
+By default every host runs at once. --parallel bounds how many run concurrently, and
+--batch-size with --batch-pause rolls through hosts in batches, waiting for each batch to finish
+(and pausing) before starting the next. --fail-fast stops scheduling new hosts after the first
+failure and --max-failures after that many; hosts not started are reported as skipped.
 
-		if len(mergedHostMap) == 0 {
-			return fmt.Errorf("no hosts provided from --hostnames or --config-file")
+Every run is saved to ~/.config/infractl/runs/<id>.json; see cluster-ssh runs and rerun.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		targets, err := resolveSshTargets(hostConnMap, configFilePath, cmdTarget)
+		if err != nil {
+			return err
 		}
-		if cmdToRun == "" {
-			return fmt.Errorf("--cmd is required")
+		job, err := newClusterSshJob(args)
+		if err != nil {
+			return err
 		}
+		return runClusterSsh(cmd, job, targets)
+	},
+}
 
-		// Execute SSH commands concurrently
-		var wg sync.WaitGroup
-		results := make(chan string, 50)
-		totalHosts := 0
-
-		for user, hosts := range mergedHostMap {
-			for _, host := range hosts {
-				totalHosts++
-				wg.Add(1)
-				go func(user, host string) {
-					defer wg.Done()
-					agent, err := ssh.NewRemoteAppDeploymentAgentWithSshKey(
-						host, user, "", "",
-						rootViperCfg.GetString("ssh_key"),
-						rootViperCfg.GetString("ssh_passphrase"),
-						nil,
-						rootViperCfg.GetBool("ssh_use_agent"),
-						rootViperCfg.GetUint("ssh_port"),
-					)
-					if err != nil {
-						results <- fmt.Sprintf("[%s@%s] connection failed: %v", user, host, err)
-						return
-					}
-					args := strings.Fields(cmdToRun)
-					output, err := agent.RunCommandAndCaptureOutput(args[0], args[1:])
-					if err != nil {
-						results <- fmt.Sprintf("[%s@%s] command error: %v", user, host, err)
-					} else {
-						results <- fmt.Sprintf("[%s@%s] success:\n%s", user, host, output)
-					}
-				}(user, host)
-			}
-		}
+// runClusterSsh runs job on targets with the scheduling and output flags and records the run
+// under ~/.config/infractl/runs.
+func runClusterSsh(cmd *cobra.Command, job *clusterSshJob, targets []sshTarget) error {
+	start := time.Now()
+	if err := job.load(); err != nil {
+		return err
+	}
+	output, err := parseClusterSshOutput(cmdOutput)
+	if err != nil {
+		return err
+	}
 
-		go func() {
-			wg.Wait()
-			close(results)
-		}()
+	ctx, stop := interruptContext(cmd)
+	defer stop()
+	sudoPassword := sudoPasswordSource()
 
-		for r := range results {
-			fmt.Println(r)
+	schedule := clusterSshSchedule{
+		Parallel:    cmdParallel,
+		BatchSize:   cmdBatchSize,
+		BatchPause:  cmdBatchPause,
+		FailFast:    cmdFailFast,
+		MaxFailures: cmdMaxFailures,
+		Command:     job.label(),
+	}
+	results := make(chan *ssh.CommandResult, len(targets))
+	go schedule.run(ctx, targets, func(target sshTarget) *ssh.CommandResult {
+		agent, err := newSshTargetAgent(target)
+		if err != nil {
+			return &ssh.CommandResult{
+				Host:     target.Host,
+				User:     target.User,
+				Command:  job.label(),
+				ExitCode: -1,
+				Err:      fmt.Errorf("connection failed: %w", err),
+			}
 		}
+		defer agent.Close()
+		agent.CommandTimeout = cmdTimeout
+		agent.SudoPassword = sudoPassword
+		return job.run(ctx, agent)
+	}, results)
 
-		duration := time.Since(start)
-		fmt.Printf("\nCompleted SSH command across %d host(s) in %.2f seconds\n", totalHosts, duration.Seconds())
+	for r := range results {
+		if err := output.add(r); err != nil {
+			return err
+		}
+	}
 
-		return nil
-	},
+	run := newClusterSshRun(start, job, targets, output.results)
+	saveErr := run.save()
+	err = output.finish(time.Since(start))
+	switch {
+	case saveErr != nil:
+		pretty.PrintWarningf("unable to save run: %s", saveErr.Error())
+	case err != nil && output.format != "json" && output.format != "yaml":
+		fmt.Printf("Retry the failed hosts with: infractl cluster-ssh rerun --failed %s\n", run.Id)
+	}
+	return err
 }
 
 func init() {
 	rootCmd.AddCommand(clusterSsh)
 
-	clusterSsh.Flags().StringVar(&cmdToRun, "cmd", "", "Command to run on all remote hosts (required)")
+	clusterSsh.Flags().StringVar(&cmdToRun, "cmd", "", "Command to run on all remote hosts through the remote shell")
+	clusterSsh.Flags().StringVar(&cmdScript, "script", "", "Local script to upload and run on all remote hosts, with arguments after --")
+	clusterSsh.Flags().StringVar(&cmdStdinFile, "stdin-file", "", "Local file piped into the command or script on each host")
+	clusterSsh.MarkFlagsMutuallyExclusive("cmd", "script")
 	clusterSsh.Flags().StringToStringVar(&hostConnMap, "hostnames", nil, "Map of username to hostnames (e.g. --hostnames root=host1,host2 --hostnames jsmith=host3)")
 	clusterSsh.Flags().StringVar(&configFilePath, "config-file", "", "Path to YAML config file containing hostnames map")
+	addTargetFlag(clusterSsh, &cmdTarget)
+	clusterSsh.Flags().BoolVar(&cmdUseSudo, "sudo", false, "Run the command with sudo, using --ask-sudo-pass or sudo_password when passwordless sudo is unavailable")
+	addClusterSshRunFlags(clusterSsh)
+}
+
+// addClusterSshRunFlags registers the output and scheduling flags shared by cluster-ssh and
+// cluster-ssh rerun.
+func addClusterSshRunFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&cmdOutput, "output", "o", "", "Output format: json, yaml, table or dir=<path> (default prints each host's output and a summary)")
+	cmd.Flags().IntVar(&cmdParallel, "parallel", 0, "Maximum number of hosts to run on at once (0 runs all hosts at once)")
+	cmd.Flags().IntVar(&cmdBatchSize, "batch-size", 0, "Run hosts in rolling batches of this size (0 disables batching)")
+	cmd.Flags().DurationVar(&cmdBatchPause, "batch-pause", 0, "Pause between batches, e.g. 30s")
+	cmd.Flags().BoolVar(&cmdFailFast, "fail-fast", false, "Stop starting new hosts after the first failure")
+	cmd.Flags().IntVar(&cmdMaxFailures, "max-failures", 0, "Stop starting new hosts once this many have failed (0 for no limit)")
+	cmd.Flags().DurationVar(&cmdTimeout, "timeout", 0, "Maximum duration for the command on each host, e.g. 30s or 5m (0 disables the timeout)")
+}
+
+// clusterSshJob is what cluster-ssh runs on every host: a shell command or an uploaded script. It
+// is saved with each run so the run can be replayed.
+type clusterSshJob struct {
+	Command    string   `json:"command,omitempty"`
+	Script     string   `json:"script,omitempty"`
+	ScriptArgs []string `json:"scriptArgs,omitempty"`
+	StdinFile  string   `json:"stdinFile,omitempty"`
+	Sudo       bool     `json:"sudo,omitempty"`
+	stdin      []byte
+}
+
+func newClusterSshJob(args []string) (*clusterSshJob, error) {
+	job := &clusterSshJob{Command: cmdToRun, Script: cmdScript, ScriptArgs: args, StdinFile: cmdStdinFile, Sudo: cmdUseSudo}
+	switch {
+	case job.Command == "" && job.Script == "":
+		return nil, fmt.Errorf("one of --cmd or --script is required")
+	case job.Command != "" && len(args) > 0:
+		return nil, fmt.Errorf("arguments after -- are only used with --script, put them in --cmd instead")
+	}
+	// Absolute paths keep the saved run replayable from another directory.
+	for _, path := range []*string{&job.Script, &job.StdinFile} {
+		if *path != "" {
+			abs, err := filepath.Abs(*path)
+			if err != nil {
+				return nil, err
+			}
+			*path = abs
+		}
+	}
+	return job, nil
+}
+
+// load reads the stdin file, if any.
+func (j *clusterSshJob) load() error {
+	if j.StdinFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(j.StdinFile)
+	if err != nil {
+		return fmt.Errorf("error reading --stdin-file: %w", err)
+	}
+	j.stdin = data
+	return nil
+}
+
+// label is the command as shown in results.
+func (j *clusterSshJob) label() string {
+	if j.Script != "" {
+		return strings.TrimSpace(filepath.Base(j.Script) + " " + strings.Join(j.ScriptArgs, " "))
+	}
+	return j.Command
+}
+
+func (j *clusterSshJob) run(ctx context.Context, agent *ssh.RemoteAppDeploymentAgent) *ssh.CommandResult {
+	var stdin io.Reader
+	if j.stdin != nil {
+		stdin = bytes.NewReader(j.stdin)
+	}
+
+	if j.Script != "" {
+		result, err := agent.RunScript(ctx, j.Script, j.ScriptArgs, ssh.ScriptOptions{Sudo: j.Sudo, Stdin: stdin})
+		if result == nil {
+			result = &ssh.CommandResult{Host: agent.Hostname, User: agent.User, Command: j.label(), ExitCode: -1, Err: err}
+		}
+		return result
+	}
+
+	// Hand the whole string to sh -c so sudo applies to all of it, not just the first word.
+	shArgs := []string{"-c", ssh.ShellQuote(j.Command)}
+	var result *ssh.CommandResult
+	if j.Sudo {
+		result, _ = agent.RunSudoCommandWithStdin(ctx, "sh", shArgs, stdin)
+	} else {
+		result, _ = agent.RunCommandWithStdin(ctx, "sh", shArgs, stdin)
+	}
+	result.Command = j.Command
+	return result
+}
+
+func printClusterSshResult(r *ssh.CommandResult) {
+	switch {
+	case r.Success():
+		fmt.Printf("[%s@%s] success (%.2fs):\n", r.User, r.Host, r.Duration.Seconds())
+	case r.ExitCode > 0:
+		fmt.Printf("[%s@%s] failed with exit code %d (%.2fs):\n", r.User, r.Host, r.ExitCode, r.Duration.Seconds())
+	default:
+		fmt.Printf("[%s@%s] error (%.2fs): %s\n", r.User, r.Host, r.Duration.Seconds(), r.Error())
+	}
+	if r.Stdout != "" {
+		fmt.Print(r.Stdout)
+	}
+	if r.Stderr != "" {
+		fmt.Printf("[%s@%s] stderr:\n%s", r.User, r.Host, r.Stderr)
+	}
 }
 
 // ─────────────────────────────────────────────
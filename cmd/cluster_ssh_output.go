@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/babbage88/infra-cli/internal/pretty"
+	"github.com/babbage88/infra-cli/ssh"
+	"github.com/goccy/go-yaml"
+)
+
+// clusterSshRecord is the serialized form of one host's result for --output json and yaml.
+type clusterSshRecord struct {
+	Host            string  `json:"host" yaml:"host"`
+	User            string  `json:"user" yaml:"user"`
+	Command         string  `json:"command" yaml:"command"`
+	Status          string  `json:"status" yaml:"status"` // ok, failed or skipped
+	ExitCode        int     `json:"exitCode" yaml:"exitCode"`
+	Stdout          string  `json:"stdout" yaml:"stdout"`
+	Stderr          string  `json:"stderr" yaml:"stderr"`
+	DurationSeconds float64 `json:"durationSeconds" yaml:"durationSeconds"`
+	Error           string  `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func newClusterSshRecord(r *ssh.CommandResult) clusterSshRecord {
+	status := "ok"
+	switch {
+	case errors.Is(r.Err, errClusterSshSkipped):
+		status = "skipped"
+	case !r.Success():
+		status = "failed"
+	}
+	return clusterSshRecord{
+		Host:            r.Host,
+		User:            r.User,
+		Command:         r.Command,
+		Status:          status,
+		ExitCode:        r.ExitCode,
+		Stdout:          r.Stdout,
+		Stderr:          r.Stderr,
+		DurationSeconds: r.Duration.Seconds(),
+		Error:           r.Error(),
+	}
+}
+
+// clusterSshOutput renders cluster-ssh results as they arrive and summarizes them at the end.
+type clusterSshOutput struct {
+	format  string // text, json, yaml, table or dir
+	dir     string
+	mu      sync.Mutex
+	results []*ssh.CommandResult
+	json    *json.Encoder
+}
+
+// parseClusterSshOutput parses --output: json, yaml, table, dir=<path>, or empty for text. With
+// json and yaml, log lines go to stderr to keep the document on stdout parseable.
+func parseClusterSshOutput(value string) (*clusterSshOutput, error) {
+	out := &clusterSshOutput{format: value}
+	switch {
+	case value == "" || value == "text":
+		out.format = "text"
+	case value == "json":
+		out.json = json.NewEncoder(os.Stdout)
+		logToStderr()
+	case value == "yaml":
+		logToStderr()
+	case value == "table":
+	case strings.HasPrefix(value, "dir="):
+		out.format = "dir"
+		out.dir = strings.TrimPrefix(value, "dir=")
+		if out.dir == "" {
+			return nil, fmt.Errorf("--output dir= requires a path")
+		}
+		if err := os.MkdirAll(out.dir, 0o755); err != nil {
+			return nil, fmt.Errorf("error creating output directory: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid --output %q, expected json, yaml, table or dir=<path>", value)
+	}
+	return out, nil
+}
+
+// add records r and prints it immediately for the streaming formats.
+func (o *clusterSshOutput) add(r *ssh.CommandResult) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.results = append(o.results, r)
+
+	switch o.format {
+	case "text":
+		printClusterSshResult(r)
+	case "json":
+		// One object per line so results can be streamed into jq.
+		return o.json.Encode(newClusterSshRecord(r))
+	case "dir":
+		return o.writeHostFiles(r)
+	}
+	return nil
+}
+
+// writeHostFiles writes r's stdout to <dir>/<user>@<host>.stdout and, when present, its stderr to
+// <user>@<host>.stderr.
+func (o *clusterSshOutput) writeHostFiles(r *ssh.CommandResult) error {
+	base := filepath.Join(o.dir, fmt.Sprintf("%s@%s", r.User, r.Host))
+	if err := os.WriteFile(base+".stdout", []byte(r.Stdout), 0o644); err != nil {
+		return fmt.Errorf("error writing output for %s: %w", r.Host, err)
+	}
+	if r.Stderr != "" {
+		if err := os.WriteFile(base+".stderr", []byte(r.Stderr), 0o644); err != nil {
+			return fmt.Errorf("error writing output for %s: %w", r.Host, err)
+		}
+	}
+	return nil
+}
+
+// finish prints the summary for the chosen format and returns an error when any host failed, so
+// the process exits non-zero.
+func (o *clusterSshOutput) finish(elapsed time.Duration) error {
+	sort.Slice(o.results, func(i, j int) bool {
+		if o.results[i].Host != o.results[j].Host {
+			return o.results[i].Host < o.results[j].Host
+		}
+		return o.results[i].User < o.results[j].User
+	})
+
+	records := o.records()
+	failed, skipped := countClusterSshStatus(records)
+
+	switch o.format {
+	case "yaml":
+		data, err := yaml.Marshal(records)
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(data)
+	case "table", "text", "dir":
+		if o.format == "text" {
+			fmt.Println()
+		}
+		printClusterSshSummary(records)
+		fmt.Printf("\nCompleted SSH command across %d host(s) in %.2f seconds: %d succeeded, %d failed, %d skipped\n",
+			len(o.results), elapsed.Seconds(), len(o.results)-failed-skipped, failed, skipped)
+		if o.format == "dir" {
+			pretty.Printf("Wrote host output to %s", o.dir)
+		}
+	}
+
+	if failed+skipped > 0 {
+		return fmt.Errorf("%d of %d host(s) failed, %d skipped", failed, len(o.results), skipped)
+	}
+	return nil
+}
+
+// records returns the results recorded so far in serializable form.
+func (o *clusterSshOutput) records() []clusterSshRecord {
+	records := make([]clusterSshRecord, 0, len(o.results))
+	for _, r := range o.results {
+		records = append(records, newClusterSshRecord(r))
+	}
+	return records
+}
+
+// countClusterSshStatus returns how many records failed and how many were skipped.
+func countClusterSshStatus(records []clusterSshRecord) (failed, skipped int) {
+	for _, r := range records {
+		switch r.Status {
+		case "failed":
+			failed++
+		case "skipped":
+			skipped++
+		}
+	}
+	return failed, skipped
+}
+
+func printClusterSshSummary(records []clusterSshRecord) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tSTATUS\tEXIT\tDURATION\tOUTPUT")
+	for _, r := range records {
+		summary := firstLine(r.Stdout)
+		if r.Status == "failed" {
+			if summary = firstLine(r.Stderr); summary == "" {
+				summary = firstLine(r.Error)
+			}
+		}
+		fmt.Fprintf(tw, "%s@%s\t%s\t%d\t%.2fs\t%s\n", r.User, r.Host, r.Status, r.ExitCode, r.DurationSeconds, summary)
+	}
+	tw.Flush()
+}
+
+// firstLine returns the first non-empty line of s, truncated for table cells.
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			if len(line) > 60 {
+				line = line[:57] + "..."
+			}
+			return line
+		}
+	}
+	return ""
+}
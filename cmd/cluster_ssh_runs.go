@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/babbage88/infra-cli/ssh"
+	"github.com/spf13/cobra"
+)
+
+// clusterSshRunsKept is how many saved runs are kept; older ones are pruned on save.
+const clusterSshRunsKept = 100
+
+var rerunFailedOnly bool
+
+// clusterSshRun is a cluster-ssh invocation saved to ~/.config/infractl/runs/<id>.json.
+type clusterSshRun struct {
+	Id              string             `json:"id"`
+	StartedAt       time.Time          `json:"startedAt"`
+	DurationSeconds float64            `json:"durationSeconds"`
+	Job             *clusterSshJob     `json:"job"`
+	Targets         []sshTarget        `json:"targets"`
+	Results         []clusterSshRecord `json:"results"`
+}
+
+func newClusterSshRun(start time.Time, job *clusterSshJob, targets []sshTarget, results []*ssh.CommandResult) *clusterSshRun {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	run := &clusterSshRun{
+		Id:              start.Format("20060102-150405") + "-" + hex.EncodeToString(suffix),
+		StartedAt:       start,
+		DurationSeconds: time.Since(start).Seconds(),
+		Job:             job,
+		Targets:         targets,
+	}
+	for _, r := range results {
+		run.Results = append(run.Results, newClusterSshRecord(r))
+	}
+	sort.Slice(run.Results, func(i, j int) bool { return run.Results[i].Host < run.Results[j].Host })
+	return run
+}
+
+func clusterSshRunsDir() string {
+	return filepath.Join(GetConfigPath(), "runs")
+}
+
+// save writes the run and prunes all but the newest clusterSshRunsKept runs.
+func (r *clusterSshRun) save() error {
+	dir := clusterSshRunsDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, r.Id+".json"), data, 0o600); err != nil {
+		return err
+	}
+
+	ids, err := listClusterSshRunIds()
+	if err != nil {
+		return err
+	}
+	for len(ids) > clusterSshRunsKept {
+		os.Remove(filepath.Join(dir, ids[0]+".json"))
+		ids = ids[1:]
+	}
+	return nil
+}
+
+// listClusterSshRunIds returns the saved run ids, oldest first. Ids start with their timestamp so
+// they sort chronologically.
+func listClusterSshRunIds() ([]string, error) {
+	entries, err := os.ReadDir(clusterSshRunsDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), ".json"); ok && !e.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// loadClusterSshRun loads the run with id, or the most recent run when id is empty.
+func loadClusterSshRun(id string) (*clusterSshRun, error) {
+	if id == "" {
+		ids, err := listClusterSshRunIds()
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("no saved cluster-ssh runs in %s", clusterSshRunsDir())
+		}
+		id = ids[len(ids)-1]
+	}
+	data, err := os.ReadFile(filepath.Join(clusterSshRunsDir(), id+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading run %s: %w", id, err)
+	}
+	run := &clusterSshRun{}
+	if err := json.Unmarshal(data, run); err != nil {
+		return nil, fmt.Errorf("error parsing run %s: %w", id, err)
+	}
+	return run, nil
+}
+
+// failedTargets returns the targets of the run that failed or were skipped.
+func (r *clusterSshRun) failedTargets() []sshTarget {
+	var failed []sshTarget
+	for _, t := range r.Targets {
+		for _, res := range r.Results {
+			if res.Host == t.Host && res.User == t.User && res.Status != "ok" {
+				failed = append(failed, t)
+				break
+			}
+		}
+	}
+	return failed
+}
+
+var clusterSshRerunCmd = &cobra.Command{
+	Use:   "rerun [run-id]",
+	Short: "Replay a saved cluster-ssh run, optionally only on the hosts that failed",
+	Long: `Replay the command or script of a saved cluster-ssh run (the latest when no run id is
+given) against the same targets, or with --failed only against the hosts that failed or were
+skipped. The rerun is saved as a new run.`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var id string
+		if len(args) == 1 {
+			id = args[0]
+		}
+		run, err := loadClusterSshRun(id)
+		if err != nil {
+			return err
+		}
+
+		targets := run.Targets
+		if rerunFailedOnly {
+			targets = run.failedTargets()
+			if len(targets) == 0 {
+				fmt.Printf("No failed hosts in run %s\n", run.Id)
+				return nil
+			}
+		}
+		fmt.Printf("Re-running %q from run %s on %d host(s)\n", run.Job.label(), run.Id, len(targets))
+		return runClusterSsh(cmd, run.Job, targets)
+	},
+}
+
+var clusterSshRunsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "List and inspect saved cluster-ssh runs",
+}
+
+var clusterSshRunsListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List saved cluster-ssh runs, newest first",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ids, err := listClusterSshRunIds()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tSTARTED\tHOSTS\tOK\tFAILED\tSKIPPED\tCOMMAND")
+		for i := len(ids) - 1; i >= 0; i-- {
+			run, err := loadClusterSshRun(ids[i])
+			if err != nil {
+				return err
+			}
+			failed, skipped := countClusterSshStatus(run.Results)
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%s\n", run.Id, run.StartedAt.Format(time.DateTime),
+				len(run.Targets), len(run.Results)-failed-skipped, failed, skipped, firstLine(run.Job.label()))
+		}
+		return tw.Flush()
+	},
+}
+
+var clusterSshRunsShowCmd = &cobra.Command{
+	Use:          "show [run-id]",
+	Short:        "Show the results of a saved cluster-ssh run (the latest by default)",
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var id string
+		if len(args) == 1 {
+			id = args[0]
+		}
+		run, err := loadClusterSshRun(id)
+		if err != nil {
+			return err
+		}
+
+		if cmdOutput == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(run)
+		}
+		fmt.Printf("Run:     %s\nStarted: %s (%.2fs)\nCommand: %s\n", run.Id, run.StartedAt.Format(time.DateTime), run.DurationSeconds, run.Job.label())
+		if run.Job.Sudo {
+			fmt.Println("Sudo:    yes")
+		}
+		fmt.Println()
+		printClusterSshSummary(run.Results)
+		return nil
+	},
+}
+
+func init() {
+	clusterSsh.AddCommand(clusterSshRerunCmd, clusterSshRunsCmd)
+	clusterSshRunsCmd.AddCommand(clusterSshRunsListCmd, clusterSshRunsShowCmd)
+
+	clusterSshRerunCmd.Flags().BoolVar(&rerunFailedOnly, "failed", false, "Only re-run hosts that failed or were skipped")
+	addClusterSshRunFlags(clusterSshRerunCmd)
+	clusterSshRunsShowCmd.Flags().StringVarP(&cmdOutput, "output", "o", "", "Set to json to print the full saved run including each host's output")
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/babbage88/infra-cli/ssh"
+)
+
+// errClusterSshSkipped marks hosts that were never run because --fail-fast or --max-failures
+// stopped scheduling, or because the run was interrupted.
+var errClusterSshSkipped = errors.New("skipped")
+
+// clusterSshSchedule controls how many hosts cluster-ssh runs at once and when it stops.
+type clusterSshSchedule struct {
+	Parallel    int           // hosts running at once within a batch, 0 for all of them
+	BatchSize   int           // hosts per rolling batch, 0 for a single batch
+	BatchPause  time.Duration // wait between batches
+	FailFast    bool          // stop scheduling after the first failure
+	MaxFailures int           // stop scheduling once this many hosts failed, 0 for no limit
+	Command     string        // reported for skipped hosts
+}
+
+// stopAfter reports whether failures is enough to stop scheduling new hosts.
+func (s clusterSshSchedule) stopAfter(failures int) bool {
+	if failures == 0 {
+		return false
+	}
+	return s.FailFast || (s.MaxFailures > 0 && failures >= s.MaxFailures)
+}
+
+// run calls fn for each target in rolling batches with bounded parallelism and sends every result,
+// including skipped hosts, to results before closing it. Hosts already running when scheduling
+// stops are allowed to finish.
+func (s clusterSshSchedule) run(ctx context.Context, targets []sshTarget, fn func(sshTarget) *ssh.CommandResult, results chan<- *ssh.CommandResult) {
+	defer close(results)
+
+	batchSize := s.BatchSize
+	if batchSize <= 0 || batchSize > len(targets) {
+		batchSize = len(targets)
+	}
+	parallel := s.Parallel
+	if parallel <= 0 || parallel > batchSize {
+		parallel = batchSize
+	}
+
+	var mu sync.Mutex
+	failures := 0
+	stopped := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return ctx.Err() != nil || s.stopAfter(failures)
+	}
+	skip := func(target sshTarget) {
+		results <- &ssh.CommandResult{Host: target.Host, User: target.User, Command: s.Command, ExitCode: -1, Err: errClusterSshSkipped}
+	}
+
+	for start := 0; start < len(targets); start += batchSize {
+		batch := targets[start:min(start+batchSize, len(targets))]
+
+		if start > 0 && s.BatchPause > 0 && !stopped() {
+			select {
+			case <-time.After(s.BatchPause):
+			case <-ctx.Done():
+			}
+		}
+
+		sem := make(chan struct{}, parallel)
+		var wg sync.WaitGroup
+		for _, target := range batch {
+			sem <- struct{}{}
+			if stopped() {
+				<-sem
+				skip(target)
+				continue
+			}
+			wg.Add(1)
+			go func(target sshTarget) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				result := fn(target)
+				if !result.Success() {
+					mu.Lock()
+					failures++
+					mu.Unlock()
+				}
+				results <- result
+			}(target)
+		}
+		wg.Wait()
+	}
+}
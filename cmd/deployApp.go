@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os/user"
+	"time"
 
 	"github.com/babbage88/infra-cli/deployer"
 	"github.com/spf13/cobra"
@@ -33,41 +35,77 @@ var deployCmd = &cobra.Command{
 	Use:          "deploy",
 	Short:        "Deploy a Go web application as a systemd service",
 	SilenceUsage: true,
+	Long: `Deploy a Go web application as a systemd service on --remote-host, or on every inventory
+host selected by --target one after another, using each host's user, port, key and jump host.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		fmt.Println("Starting Cobra deploy command", "AppName", deployFlags.AppName)
-		enVars := deployer.WithEnvars(deployFlags.EnvVars)
-		serviceAccount := make(map[int64]string)
-		serviceAccount[deployFlags.ServiceUid] = deployFlags.ServiceUser
-		svcUser := deployer.WithServiceAccount(serviceAccount)
-		appDeployer := deployer.NewRemoteSystemdDeployer(deployFlags.RemoteHostName,
-			deployFlags.RemoteSshUser,
-			deployFlags.AppName,
-			deployFlags.SourceDir,
-			enVars,
-			svcUser,
-			deployer.WithInstallDir(deployFlags.InstallDir),
-			deployer.WithSystemdDir(deployFlags.SystemdDir),
-			deployer.WithDestinationBin(deployFlags.DestinationBinary),
-			deployer.WithSourceBin(deployFlags.SourceBin),
-			deployer.WithSourceDir(deployFlags.SourceDir),
-		)
-		err := appDeployer.StartSshDeploymentAgent(
-			rootViperCfg.GetString("ssh_key"),
-			rootViperCfg.GetString("ssh_passphrase"),
-			deployFlags.EnvVars,
-			rootViperCfg.GetBool("ssh_use_agent"),
-			rootViperCfg.GetUint("ssh_port"),
-		)
-		defer appDeployer.SshClient.SshClient.Close()
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+
+		if deployFlags.Target == "" {
+			appDeployer := newAppDeployer(deployFlags.RemoteHostName, deployFlags.RemoteSshUser)
+			err := appDeployer.StartSshDeploymentAgent(
+				rootViperCfg.GetString("ssh_key"),
+				rootViperCfg.GetString("ssh_passphrase"),
+				deployFlags.EnvVars,
+				rootViperCfg.GetBool("ssh_use_agent"),
+				rootViperCfg.GetUint("ssh_port"),
+			)
+			if err != nil {
+				return fmt.Errorf("Error initializing ssh client %w", err)
+			}
+			defer appDeployer.SshClient.Close()
+			slog.Info("Starting application installer", slog.String("RemoteHost", deployFlags.RemoteHostName), slog.String("AppName", deployFlags.AppName))
+			return appDeployer.InstallApplication(ctx)
+		}
+
+		targets, err := selectSshTargets(deployFlags.Target)
 		if err != nil {
-			return fmt.Errorf("Error initializing ssh client %w", err)
+			return err
 		}
-		slog.Info("Starting application installer", slog.String("RemoteHost", deployFlags.RemoteHostName), slog.String("AppName", deployFlags.AppName))
-		err = appDeployer.InstallApplication()
-		return err
+		for _, target := range targets {
+			if err := deployToTarget(ctx, target); err != nil {
+				return fmt.Errorf("deployment to %s failed: %w", target, err)
+			}
+		}
+		return nil
 	},
 }
 
+// newAppDeployer builds the systemd deployer for one host from the deploy flags.
+func newAppDeployer(hostname, sshUser string) *deployer.RemoteSystemdBinDeployer {
+	serviceAccount := make(map[int64]string)
+	serviceAccount[deployFlags.ServiceUid] = deployFlags.ServiceUser
+	return deployer.NewRemoteSystemdDeployer(hostname,
+		sshUser,
+		deployFlags.AppName,
+		deployFlags.SourceDir,
+		deployer.WithEnvars(deployFlags.EnvVars),
+		deployer.WithServiceAccount(serviceAccount),
+		deployer.WithInstallDir(deployFlags.InstallDir),
+		deployer.WithSystemdDir(deployFlags.SystemdDir),
+		deployer.WithDestinationBin(deployFlags.DestinationBinary),
+		deployer.WithSourceBin(deployFlags.SourceBin),
+		deployer.WithSourceDir(deployFlags.SourceDir),
+		deployer.WithCommandTimeout(deployFlags.CommandTimeout),
+		deployer.WithSudoPassword(sudoPasswordSource()),
+	)
+}
+
+func deployToTarget(ctx context.Context, target sshTarget) error {
+	agent, err := newSshTargetAgent(target)
+	if err != nil {
+		return fmt.Errorf("Error initializing ssh client %w", err)
+	}
+	defer agent.Close()
+	agent.EnvVars = deployFlags.EnvVars
+
+	appDeployer := newAppDeployer(target.Host, target.User)
+	appDeployer.UseSshDeploymentAgent(agent)
+	slog.Info("Starting application installer", slog.String("RemoteHost", target.Host), slog.String("AppName", deployFlags.AppName))
+	return appDeployer.InstallApplication(ctx)
+}
+
 // Struct for storing deployment flags
 type DeployFlags struct {
 	RemoteHostName    string            `mapstructure:"remote-host"`
@@ -86,6 +124,8 @@ type DeployFlags struct {
 	RemoteDeployment  bool              `mapstructure:"remote-deployment"`
 	DeployBinary      bool              `mapstructure:"deploy-binary"`
 	VerboseLogging    bool              `mapstructure:"verbose"`
+	CommandTimeout    time.Duration     `mapstructure:"timeout"`
+	Target            string            `mapstructure:"target"`
 }
 
 var deployFlags DeployFlags
@@ -111,6 +151,9 @@ func init() {
 	deployCmd.Flags().BoolVar(&deployFlags.VerboseLogging, "verbose", true, "Verbose build logging.")
 	deployCmd.Flags().StringVar(&deployFlags.RemoteSshUser, "remote-ssh-user", curUser, "Remote SSH user to connect with")
 	deployCmd.Flags().StringSliceVar(&deployFlags.SourceExcludes, "exclude-files", nil, "Files to exclude durign build")
+	deployCmd.Flags().DurationVar(&deployFlags.CommandTimeout, "timeout", 0, "Maximum duration for each remote command, e.g. 30s or 5m (0 disables the timeout)")
+
+	addTargetFlag(deployCmd, &deployFlags.Target)
 
 	// Bind the flags with viper
 	viper.BindPFlags(deployCmd.Flags())
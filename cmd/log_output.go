@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// logWriter is where the default slog handler writes, switchable after the logger is set up.
+type logWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+var defaultLogWriter = &logWriter{w: os.Stdout}
+
+// LogWriter returns the writer for the default logger. It writes to stdout until a command that
+// prints json or yaml calls logToStderr.
+func LogWriter() io.Writer {
+	return defaultLogWriter
+}
+
+// logToStderr sends log lines to stderr so they do not end up in a document written to stdout.
+func logToStderr() {
+	defaultLogWriter.mu.Lock()
+	defer defaultLogWriter.mu.Unlock()
+	defaultLogWriter.w = os.Stderr
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// batchResult is the outcome of one create-batch entry, printed as a table or with -o json.
+type batchResult struct {
+	Name            string  `json:"name"`
+	VmId            int     `json:"vmid"`
+	Node            string  `json:"node"`
+	Status          string  `json:"status"` // created, skipped or failed
+	Reason          string  `json:"reason,omitempty"`
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// batchSchedule controls how many guests create-batch creates at once and when it stops.
+type batchSchedule struct {
+	Parallel        int  // guests created at once, at least 1
+	PerNode         int  // guests created at once on the same node, 0 for no limit
+	ContinueOnError bool // keep starting entries after one failed
+}
+
+// run calls create for every entry whose result has no status yet, at most Parallel at once and
+// PerNode per node, and fills in the outcome. Without ContinueOnError, entries not yet started when
+// one fails are skipped; those already running finish.
+func (s batchSchedule) run(ctx context.Context, results []*batchResult, create func(ctx context.Context, i int, out io.Writer) error, out io.Writer) {
+	parallel := max(s.Parallel, 1)
+	sem := make(chan struct{}, parallel)
+	nodeSems := make(map[string]chan struct{})
+	for _, r := range results {
+		if _, ok := nodeSems[r.Node]; !ok && s.PerNode > 0 {
+			nodeSems[r.Node] = make(chan struct{}, s.PerNode)
+		}
+	}
+
+	var mu sync.Mutex
+	failed := false
+	stopReason := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case ctx.Err() != nil:
+			return "interrupted"
+		case failed && !s.ContinueOnError:
+			return "not started after an earlier failure"
+		}
+		return ""
+	}
+
+	var wg sync.WaitGroup
+	for i, result := range results {
+		if result.Status != "" {
+			continue
+		}
+
+		// Entries start in file order. An entry waiting for its node holds up the ones after it,
+		// which keeps the order predictable at the cost of some idle slots.
+		nodeSem := nodeSems[result.Node]
+		if nodeSem != nil {
+			nodeSem <- struct{}{}
+		}
+		sem <- struct{}{}
+		release := func() {
+			<-sem
+			if nodeSem != nil {
+				<-nodeSem
+			}
+		}
+		if reason := stopReason(); reason != "" {
+			result.Status, result.Reason = "skipped", reason
+			release()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer release()
+			var entryOut io.Writer = out
+			if parallel > 1 {
+				prefixed := newLinePrefixWriter(out, fmt.Sprintf("[%s] ", result.Name))
+				defer prefixed.Flush()
+				entryOut = prefixed
+			}
+			start := time.Now()
+			err := create(ctx, i, entryOut)
+			result.DurationSeconds = time.Since(start).Seconds()
+			if err != nil {
+				result.Status, result.Reason = "failed", err.Error()
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+				return
+			}
+			result.Status = "created"
+		}()
+	}
+	wg.Wait()
+}
+
+// printBatchResults prints the results as a table, or as a JSON list when output is json, and
+// returns an error when any entry failed so the process exits non-zero. noun names the kind of
+// guest in that error, such as "container(s)".
+func printBatchResults(results []*batchResult, output, noun string) error {
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.Status]++
+	}
+
+	if output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println()
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tVMID\tNODE\tSTATUS\tDURATION\tREASON")
+		for _, r := range results {
+			vmid := "-"
+			if r.VmId != 0 {
+				vmid = fmt.Sprint(r.VmId)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%.1fs\t%s\n", r.Name, vmid, r.Node, r.Status, r.DurationSeconds, firstLine(r.Reason))
+		}
+		tw.Flush()
+		fmt.Printf("\n%d created, %d skipped, %d failed\n", counts["created"], counts["skipped"], counts["failed"])
+	}
+
+	if counts["failed"] > 0 {
+		return fmt.Errorf("%d of %d %s failed", counts["failed"], len(results), noun)
+	}
+	return nil
+}
+
+// linePrefixWriter prefixes every line written to it, so output from guests created in
+// parallel can be told apart. Complete lines are written to the shared writer under one lock.
+type linePrefixWriter struct {
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+var linePrefixMu sync.Mutex
+
+func newLinePrefixWriter(w io.Writer, prefix string) *linePrefixWriter {
+	return &linePrefixWriter{w: w, prefix: prefix}
+}
+
+func (p *linePrefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		err := p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+		if err != nil {
+			return len(b), err
+		}
+	}
+}
+
+// Flush writes a last line that did not end in a newline, adding one.
+func (p *linePrefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	err := p.writeLine(append(p.buf, '\n'))
+	p.buf = nil
+	return err
+}
+
+func (p *linePrefixWriter) writeLine(line []byte) error {
+	linePrefixMu.Lock()
+	defer linePrefixMu.Unlock()
+	_, err := fmt.Fprintf(p.w, "%s%s", p.prefix, line)
+	return err
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/babbage88/infra-cli/proxmox"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// newProxmoxClient returns the API client shared by the proxmox commands. Task logs are streamed
+// to stdout while commands wait for them, unless opts says otherwise.
+func newProxmoxClient(auth proxmox.Auth, opts ...proxmox.ClientOption) (*proxmox.Client, error) {
+	return proxmox.NewClient(auth, append([]proxmox.ClientOption{proxmox.WithTaskOutput(os.Stdout)}, opts...)...)
+}
+
+// proxmoxAuthFromConfig reads the cluster URL, API token and TLS settings from a loaded Proxmox
+// config file (and any flags bound to it), falling back to the proxmox_* keys of the root config.
+//
+//	host_url: https://pve1.example.com:8006
+//	api_token: root@pam!infractl=...
+//	ca_bundle: ~/.config/infractl/pve-ca.pem
+//	fingerprint: AB:CD:...
+//	insecure_skip_verify: false
+func proxmoxAuthFromConfig(vp *viper.Viper) proxmox.Auth {
+	return proxmox.Auth{
+		Host:     cmp.Or(vp.GetString("host_url"), rootViperCfg.GetString("proxmox_host_url")),
+		ApiToken: cmp.Or(vp.GetString("api_token"), rootViperCfg.GetString("proxmox_api_token")),
+		TLS:      proxmoxTLSFromConfig(vp, proxmox.TLSOptions{}),
+	}
+}
+
+// proxmoxTLSFromConfig fills any TLS settings not already set in opts from vp and then the root
+// config.
+func proxmoxTLSFromConfig(vp *viper.Viper, opts proxmox.TLSOptions) proxmox.TLSOptions {
+	opts.CABundle = expandHome(cmp.Or(opts.CABundle, vp.GetString("ca_bundle"), rootViperCfg.GetString("proxmox_ca_bundle")))
+	opts.Fingerprint = cmp.Or(opts.Fingerprint, vp.GetString("fingerprint"), rootViperCfg.GetString("proxmox_fingerprint"))
+	opts.InsecureSkipVerify = opts.InsecureSkipVerify || vp.GetBool("insecure_skip_verify") || rootViperCfg.GetBool("proxmox_insecure_skip_verify")
+	return opts
+}
+
+// addProxmoxTLSFlags registers the per-cluster TLS flags, bound to the config keys of the same
+// name with bindLocalFlags.
+func addProxmoxTLSFlags(cmd *cobra.Command) {
+	cmd.Flags().String("ca-bundle", "", "PEM file with the CA certificate(s) that signed the Proxmox API certificate")
+	cmd.Flags().String("fingerprint", "", "Pinned SHA-256 fingerprint of the Proxmox API certificate, e.g. AB:CD:...")
+	cmd.Flags().Bool("insecure-skip-verify", false, "Skip Proxmox API certificate verification entirely")
+}
+
+// addProxmoxConnFlags registers the flags for reaching a cluster: --config-file (the same file
+// create takes), --host-url, --api-token and the TLS flags.
+func addProxmoxConnFlags(cmd *cobra.Command) {
+	cmd.Flags().String("config-file", "", "Path to YAML config file containing proxmox connection info")
+	cmd.Flags().String("host-url", "", "Proxmox host URL")
+	cmd.Flags().String("api-token", "", "Proxmox API token")
+	addProxmoxTLSFlags(cmd)
+}
+
+// proxmoxClientFromFlags loads --config-file, applies the flags registered by addProxmoxConnFlags
+// over it and returns a client for the cluster.
+func proxmoxClientFromFlags(cmd *cobra.Command) (*proxmox.Client, error) {
+	vp := viper.New()
+	if cfgFile, _ := cmd.Flags().GetString("config-file"); cfgFile != "" {
+		if err := loadProxmoxConfigFile(expandHome(cfgFile), vp); err != nil {
+			return nil, err
+		}
+	}
+	bindLocalFlags(cmd, vp)
+
+	auth := proxmoxAuthFromConfig(vp)
+	if auth.Host == "" || auth.ApiToken == "" {
+		return nil, fmt.Errorf("no Proxmox host_url and api_token: pass --config-file, --host-url and --api-token, or set proxmox_host_url and proxmox_api_token in the config")
+	}
+	return newProxmoxClient(auth)
+}
+
+// proxmoxVmIdRanges returns the named VMID ranges from the vmid_ranges key of the Proxmox config
+// file, over the proxmox_vmid_ranges root config. Names are usually pools or environments.
+//
+//	vmid_ranges:
+//	  dev: 200-299
+//	  prod: 300-399
+func proxmoxVmIdRanges(vp *viper.Viper) map[string]string {
+	ranges := rootViperCfg.GetStringMapString("proxmox_vmid_ranges")
+	maps.Copy(ranges, vp.GetStringMapString("vmid_ranges"))
+	return ranges
+}
+
+// parseProxmoxVmIdRange resolves a range name from ranges or a literal min-max. An empty value is
+// the zero range, any free VMID.
+func parseProxmoxVmIdRange(ranges map[string]string, value string) (proxmox.VmIdRange, error) {
+	if value == "" {
+		return proxmox.VmIdRange{}, nil
+	}
+	if named, ok := ranges[value]; ok {
+		value = named
+	} else if !strings.Contains(value, "-") {
+		return proxmox.VmIdRange{}, fmt.Errorf("no VMID range named %q in vmid_ranges", value)
+	}
+	return proxmox.ParseVmIdRange(value)
+}
+
+// parseVmIdFlag parses --vmid, where auto (or empty) means allocate one and returns 0.
+func parseVmIdFlag(value string) (int, error) {
+	if value == "" || value == "auto" {
+		return 0, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 100 {
+		return 0, fmt.Errorf("invalid --vmid %q, expected auto or a number >= 100", value)
+	}
+	return id, nil
+}
+
+// unmarshalViperKey decodes a structured config key into out through JSON, so the json tags of
+// the proxmox types apply. A missing key leaves out unchanged.
+func unmarshalViperKey(vp *viper.Viper, key string, out any) error {
+	if !vp.IsSet(key) {
+		return nil
+	}
+	data, err := json.Marshal(vp.Get(key))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// waitForTaskResult returns a function taking the (upid, err) result of a client call and waiting
+// for the task on node, so calls read waitForTaskResult(ctx, client, node)(client.StartLxc(...)).
+// Calls that finished without queueing a task return an empty UPID, which is not waited for.
+func waitForTaskResult(ctx context.Context, client *proxmox.Client, node string) func(string, error) error {
+	return func(upid string, err error) error {
+		if err != nil || upid == "" {
+			return err
+		}
+		_, err = client.WaitForTask(ctx, node, upid)
+		return err
+	}
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/babbage88/infra-cli/providers/cloudflare_utils"
+	"github.com/babbage88/infra-cli/proxmox"
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/spf13/viper"
+)
+
+// lxcDnsMarker prefixes the line added to a container's description for every DNS record
+// infractl creates for it, so destroy knows which records to remove again.
+const lxcDnsMarker = "infractl-dns:"
+
+// lxcDnsCommentPrefix starts the comment of every DNS record infractl creates. The comment names
+// the container, so records are only ever replaced or removed by infractl and only removed for the
+// container they point at.
+const lxcDnsCommentPrefix = "managed by infractl for CT "
+
+// lxcDnsWaitTimeout is how long to wait for a new container to report its IP address.
+const lxcDnsWaitTimeout = 5 * time.Minute
+
+// lxcDnsRecord is an A/AAAA record pointing at a container's address.
+type lxcDnsRecord struct {
+	Name  string
+	Zone  string
+	TTL   int
+	Force bool // replace an existing record infractl did not create
+}
+
+// lxcDnsRecordFromConfig returns the record for name in the zone from dns_zone (--dns-zone),
+// falling back to the root domain_name, or nil when name is empty. force (--force) allows
+// replacing a record infractl did not create.
+func lxcDnsRecordFromConfig(vp *viper.Viper, name string) (*lxcDnsRecord, error) {
+	if name == "" {
+		return nil, nil
+	}
+	zone := vp.GetString("dns_zone")
+	if zone == "" {
+		zone = rootViperCfg.GetString("domain_name")
+	}
+	if zone == "" {
+		return nil, fmt.Errorf("no DNS zone for record %s, set --dns-zone or domain_name", name)
+	}
+	ttl := vp.GetInt("dns_ttl")
+	if ttl == 0 {
+		ttl = 120
+	}
+	return &lxcDnsRecord{Name: name, Zone: zone, TTL: ttl, Force: vp.GetBool("force")}, nil
+}
+
+// FQDN returns the fully qualified record name.
+func (r lxcDnsRecord) FQDN() string {
+	return cloudflare_utils.RecordFQDN(r.Name, r.Zone)
+}
+
+// marker returns the description line that records r on the container.
+func (r lxcDnsRecord) marker() string {
+	return fmt.Sprintf("%s %s zone=%s", lxcDnsMarker, r.FQDN(), r.Zone)
+}
+
+// addLxcDnsMarker appends the marker for r to the description of lxc.
+func addLxcDnsMarker(lxc *proxmox.LxcContainer, r lxcDnsRecord) {
+	if lxc.Description == "" {
+		lxc.Description = r.marker()
+		return
+	}
+	lxc.Description = strings.TrimRight(lxc.Description, "\n") + "\n" + r.marker()
+}
+
+// parseLxcDnsMarkers returns the records named by the marker lines in a container description.
+func parseLxcDnsMarkers(description string) []lxcDnsRecord {
+	var records []lxcDnsRecord
+	scanner := bufio.NewScanner(strings.NewReader(description))
+	for scanner.Scan() {
+		line, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), lxcDnsMarker)
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "zone=") {
+			continue
+		}
+		records = append(records, lxcDnsRecord{Name: fields[0], Zone: strings.TrimPrefix(fields[1], "zone=")})
+	}
+	return records
+}
+
+// cloudflareDnsToken returns the cloudflare entry of api_tokens.
+func cloudflareDnsToken() (string, error) {
+	token := apiTokens["cloudflare"]
+	if token == "" {
+		token = rootViperCfg.GetStringMapString("api_tokens")["cloudflare"]
+	}
+	if token == "" {
+		return "", fmt.Errorf("no cloudflare token in api_tokens, needed to manage DNS records")
+	}
+	return token, nil
+}
+
+// lxcDnsComment returns the comment marking a DNS record as created by infractl for CT vmid.
+func lxcDnsComment(vmid int) string {
+	return fmt.Sprintf("%s%d", lxcDnsCommentPrefix, vmid)
+}
+
+// registerLxcDns waits for a started container to report its IP address and points r at it,
+// using an A record for IPv4 and AAAA for IPv6. An existing record of that type is updated when
+// infractl created it, or with r.Force.
+func registerLxcDns(ctx context.Context, client *proxmox.Client, lxc proxmox.LxcContainer, r lxcDnsRecord, out io.Writer) error {
+	token, err := cloudflareDnsToken()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Waiting for container %d to get an IP address...\n", lxc.VmId)
+	addr, err := client.WaitForLxcAddress(ctx, lxc.Node, lxc.VmId, lxcDnsWaitTimeout)
+	if err != nil {
+		return err
+	}
+
+	recordType := "AAAA"
+	if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil {
+		recordType = "A"
+	}
+	record, err := cloudflare_utils.UpsertDnsRecord(ctx, token, r.Zone, cloudflare.CreateDNSRecordParams{
+		Type:    recordType,
+		Name:    r.Name,
+		Content: addr,
+		TTL:     r.TTL,
+		Comment: lxcDnsComment(lxc.VmId),
+	}, func(existing cloudflare.DNSRecord) bool {
+		return r.Force || strings.HasPrefix(existing.Comment, lxcDnsCommentPrefix)
+	})
+	if errors.Is(err, cloudflare_utils.ErrDnsRecordNotOwned) {
+		return fmt.Errorf("%w; it was not created by infractl, pass --force to replace it", err)
+	}
+	if err != nil {
+		return fmt.Errorf("error registering DNS record %s: %w", r.FQDN(), err)
+	}
+	fmt.Fprintf(out, "DNS record %s %s -> %s\n", record.Type, record.Name, record.Content)
+	return nil
+}
+
+// lxcDnsRecords returns the records infractl registered for ct, read from its description.
+func lxcDnsRecords(ctx context.Context, client *proxmox.Client, ct proxmox.Guest) ([]lxcDnsRecord, error) {
+	config, err := client.GuestConfig(ctx, ct)
+	if err != nil {
+		return nil, err
+	}
+	description, _ := config["description"].(string)
+	return parseLxcDnsMarkers(description), nil
+}
+
+// unregisterLxcDns removes the A and AAAA records of every record in records that infractl created
+// for CT vmid. Records since taken over by another container, for example its replacement, stay.
+func unregisterLxcDns(ctx context.Context, vmid int, records []lxcDnsRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	token, err := cloudflareDnsToken()
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		owned := func(record cloudflare.DNSRecord) bool { return record.Comment == lxcDnsComment(vmid) }
+		deleted, err := cloudflare_utils.DeleteDnsRecordsByName(ctx, token, r.Zone, r.Name, owned, "A", "AAAA")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d DNS record(s) for %s\n", deleted, r.FQDN())
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/babbage88/infra-cli/internal/pretty"
+	"github.com/babbage88/infra-cli/provision"
+	"github.com/babbage88/infra-cli/proxmox"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var proxmoxLxcApplyCmd = &cobra.Command{
+	Use:   "apply -f <file>",
+	Short: "Make the containers in a batch YAML file match the cluster, creating and updating as needed",
+	Long: `Treat a create-batch YAML file as desired state. Each entry is matched to an existing container
+by vmid, or by hostname when it has none. Missing containers are created, and containers whose
+hostname, memory, swap, cores, CPU limits, DNS settings, description, tags, startup order or network
+interfaces differ are updated in place. Other settings such as the template and root disk only
+apply when creating.
+
+Every container apply creates or updates carries the --managed-tag tag, by default infractl-<file
+name> so each file manages its own containers. With --prune, containers with that tag that are no
+longer in the file are destroyed. An entry whose vmid belongs to a container without that tag and
+with another hostname is refused, unless --adopt allows taking the container over.
+
+The plan is printed first and applied after confirmation, or straight away with --yes.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		localViper := viper.New()
+		if cfgFile, _ := cmd.Flags().GetString("config-file"); cfgFile != "" {
+			if err := loadProxmoxConfigFile(expandHome(cfgFile), localViper); err != nil {
+				return err
+			}
+		}
+		bindLocalFlags(cmd, localViper)
+
+		entries, err := loadLxcBatchFile(localViper.GetString("file"))
+		if err != nil {
+			return err
+		}
+		managedTag := localViper.GetString("managed_tag")
+		if managedTag == "" {
+			managedTag = lxcManagedTag(localViper.GetString("file"))
+		}
+		for i := range entries {
+			entries[i].Tags = addLxcTag(entries[i].Tags, managedTag)
+		}
+		spec, err := prepareLxcBatch(localViper, entries)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+		client, err := newProxmoxClient(proxmoxAuthFromConfig(localViper))
+		if err != nil {
+			return err
+		}
+
+		plan, err := planLxcApply(ctx, client, entries, managedTag, localViper.GetBool("prune"), localViper.GetBool("adopt"))
+		if err != nil {
+			return err
+		}
+		plan.print()
+		if localViper.GetBool("dry_run") || !plan.hasChanges() {
+			return nil
+		}
+		if !localViper.GetBool("yes") && !confirm("Apply this plan?") {
+			return fmt.Errorf("aborted")
+		}
+		return plan.apply(ctx, client, localViper, spec, lxcStopOptionsFromFlags(cmd), localViper.GetBool("purge"))
+	},
+}
+
+func init() {
+	proxmoxLxcSubCmd.AddCommand(proxmoxLxcApplyCmd)
+
+	addProxmoxConnFlags(proxmoxLxcApplyCmd)
+	addLxcStopFlags(proxmoxLxcApplyCmd)
+	proxmoxLxcApplyCmd.Flags().StringP("file", "f", "", "Path to the YAML file with the desired containers, as for create-batch")
+	proxmoxLxcApplyCmd.Flags().String("vmid-range", "", "VMID range for new entries without a vmid: a name from vmid_ranges or min-max")
+	proxmoxLxcApplyCmd.Flags().String("provision", "", "Provisioning file with steps to run over ssh on every container apply creates")
+	proxmoxLxcApplyCmd.Flags().String("dns-zone", "", "Cloudflare zone for entries with a dns_record (default domain_name)")
+	proxmoxLxcApplyCmd.Flags().Int("dns-ttl", 120, "TTL for dns_record entries")
+	proxmoxLxcApplyCmd.Flags().Bool("force", false, "Replace existing dns_record records that infractl did not create")
+	proxmoxLxcApplyCmd.Flags().String("managed-tag", "", "Tag marking the containers this file manages (default infractl-<file name>)")
+	proxmoxLxcApplyCmd.Flags().Bool("adopt", false, "Take over containers matched by vmid that have neither the managed tag nor the entry's hostname")
+	proxmoxLxcApplyCmd.Flags().Bool("prune", false, "Destroy containers with the managed tag that are not in the file")
+	proxmoxLxcApplyCmd.Flags().Bool("purge", false, "With --prune, also remove destroyed containers from backup jobs, replication and HA")
+	proxmoxLxcApplyCmd.Flags().Bool("dry-run", false, "Only print the plan")
+	proxmoxLxcApplyCmd.Flags().BoolP("yes", "y", false, "Apply without asking for confirmation")
+}
+
+// lxcApplyAction is what apply does for one container.
+type lxcApplyAction string
+
+const (
+	lxcApplyCreate    lxcApplyAction = "+"
+	lxcApplyUpdate    lxcApplyAction = "~"
+	lxcApplyDelete    lxcApplyAction = "-"
+	lxcApplyUnchanged lxcApplyAction = "="
+)
+
+// lxcApplyStep is one line of the plan. Entry is nil for deletes, Guest is unset for creates.
+type lxcApplyStep struct {
+	Action  lxcApplyAction
+	Entry   *lxcBatchEntry
+	Guest   proxmox.Guest
+	Changes []proxmox.LxcChange
+	Note    string
+}
+
+type lxcApplyPlan struct {
+	Steps     []lxcApplyStep
+	Unmanaged []proxmox.Guest // carry the managed tag but are not in the file, without --prune
+}
+
+// planLxcApply matches every entry to an existing container and works out what has to change. A
+// container matched by vmid that has neither managedTag nor the entry's hostname is probably not
+// the one the entry means, so it is refused unless adopt is set.
+func planLxcApply(ctx context.Context, client *proxmox.Client, entries []lxcBatchEntry, managedTag string, prune, adopt bool) (*lxcApplyPlan, error) {
+	guests, err := client.ClusterGuests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &lxcApplyPlan{}
+	matched := make(map[int]string)
+	for i := range entries {
+		entry := &entries[i]
+		guest, found, err := matchLxcEntry(guests, entry.LxcContainer)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			plan.Steps = append(plan.Steps, lxcApplyStep{Action: lxcApplyCreate, Entry: entry})
+			continue
+		}
+		if !adopt && guest.Name != entry.Hostname && !slices.Contains(guest.Tags, managedTag) {
+			return nil, fmt.Errorf("%s: VMID %d is container %s, which is not managed by this file; fix the vmid or pass --adopt to take it over",
+				entry.Hostname, guest.VmId, guest.Name)
+		}
+		if other, ok := matched[guest.VmId]; ok {
+			return nil, fmt.Errorf("%s and %s both match container %d", other, entry.Hostname, guest.VmId)
+		}
+		matched[guest.VmId] = entry.Hostname
+
+		config, err := client.GuestConfig(ctx, guest)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config of container %d: %w", guest.VmId, err)
+		}
+		step := lxcApplyStep{Action: lxcApplyUnchanged, Entry: entry, Guest: guest, Changes: entry.Diff(config)}
+		if len(step.Changes) > 0 {
+			step.Action = lxcApplyUpdate
+		}
+		if entry.Node != "" && entry.Node != guest.Node {
+			step.Note = fmt.Sprintf("is on %s, not %s; apply does not migrate containers", guest.Node, entry.Node)
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+
+	for _, g := range guests {
+		if g.Type != "lxc" || g.Template || !slices.Contains(g.Tags, managedTag) {
+			continue
+		}
+		if _, ok := matched[g.VmId]; ok {
+			continue
+		}
+		if prune {
+			plan.Steps = append(plan.Steps, lxcApplyStep{Action: lxcApplyDelete, Guest: g})
+		} else {
+			plan.Unmanaged = append(plan.Unmanaged, g)
+		}
+	}
+	return plan, nil
+}
+
+// matchLxcEntry finds the existing container for lxc by VMID, or by hostname when it has none.
+func matchLxcEntry(guests []proxmox.Guest, lxc proxmox.LxcContainer) (proxmox.Guest, bool, error) {
+	if lxc.VmId != 0 {
+		for _, g := range guests {
+			if g.VmId != lxc.VmId {
+				continue
+			}
+			if g.Type != "lxc" || g.Template {
+				return g, false, fmt.Errorf("%s: VMID %d is already used by %s %s", lxc.Hostname, lxc.VmId, g.Type, g.Name)
+			}
+			return g, true, nil
+		}
+		return proxmox.Guest{}, false, nil
+	}
+
+	var matches []proxmox.Guest
+	for _, g := range guests {
+		if g.Type == "lxc" && !g.Template && g.Name == lxc.Hostname {
+			matches = append(matches, g)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return proxmox.Guest{}, false, nil
+	case 1:
+		return matches[0], true, nil
+	default:
+		return proxmox.Guest{}, false, fmt.Errorf("%s: %d containers have this hostname, set the vmid in the file", lxc.Hostname, len(matches))
+	}
+}
+
+func (p *lxcApplyPlan) hasChanges() bool {
+	return slices.ContainsFunc(p.Steps, func(s lxcApplyStep) bool { return s.Action != lxcApplyUnchanged })
+}
+
+func (p *lxcApplyPlan) print() {
+	counts := make(map[lxcApplyAction]int)
+	for _, s := range p.Steps {
+		counts[s.Action]++
+		switch s.Action {
+		case lxcApplyCreate:
+			vmid := "vmid auto"
+			if s.Entry.VmId != 0 {
+				vmid = fmt.Sprint(s.Entry.VmId)
+			}
+			fmt.Printf("  %s %s (%s) on %s\n", s.Action, s.Entry.Hostname, vmid, s.Entry.Node)
+		default:
+			fmt.Printf("  %s %s (%d) on %s\n", s.Action, s.Guest.Name, s.Guest.VmId, s.Guest.Node)
+			for _, c := range s.Changes {
+				fmt.Printf("      %s\n", c)
+			}
+		}
+		if s.Note != "" {
+			pretty.PrintWarningf("%s %s", s.Entry.Hostname, s.Note)
+		}
+	}
+	for _, g := range p.Unmanaged {
+		fmt.Printf("  ? %s (%d) on %s is not in the file, --prune destroys it\n", g.Name, g.VmId, g.Node)
+	}
+	fmt.Printf("Plan: %d to create, %d to update, %d to destroy, %d unchanged.\n",
+		counts[lxcApplyCreate], counts[lxcApplyUpdate], counts[lxcApplyDelete], counts[lxcApplyUnchanged])
+}
+
+// apply carries out the plan, going on with the remaining steps when one fails.
+func (p *lxcApplyPlan) apply(ctx context.Context, client *proxmox.Client, vp *viper.Viper, spec *provision.Spec, stopOpts lxcStopOptions, purge bool) error {
+	var vmids []batchVmId
+	for _, s := range p.Steps {
+		if s.Action == lxcApplyCreate {
+			vmids = append(vmids, batchVmId{Name: s.Entry.Hostname, Pool: s.Entry.Pool, VmId: &s.Entry.VmId})
+		}
+	}
+	if err := allocateBatchVmIds(ctx, client, vp, vmids, os.Stdout); err != nil {
+		return err
+	}
+
+	failed, total := 0, 0
+	for _, s := range p.Steps {
+		var err error
+		switch s.Action {
+		case lxcApplyCreate:
+			err = createLxcBatchEntry(ctx, client, *s.Entry, spec, os.Stdout)
+		case lxcApplyUpdate:
+			fmt.Printf("Updating container %d (%s)...\n", s.Guest.VmId, s.Guest.Name)
+			err = client.UpdateLxcConfig(ctx, s.Guest.Node, s.Guest.VmId, proxmox.LxcChangeParams(s.Changes))
+		case lxcApplyDelete:
+			fmt.Printf("Destroying container %d (%s)...\n", s.Guest.VmId, s.Guest.Name)
+			err = destroyLxc(ctx, client, s.Guest, stopOpts, purge)
+		default:
+			continue
+		}
+		total++
+		if err != nil {
+			failed++
+			pretty.PrintErrorf("%s %s: %v", s.Action, lxcApplyStepName(s), err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d change(s) failed", failed, total)
+	}
+	fmt.Printf("Applied %d change(s).\n", total)
+	return nil
+}
+
+func lxcApplyStepName(s lxcApplyStep) string {
+	if s.Entry != nil {
+		return s.Entry.Hostname
+	}
+	return s.Guest.Name
+}
+
+// lxcManagedTag returns the default managed tag for a batch file, infractl-<file name> lowercased
+// and limited to the characters Proxmox allows in tags.
+func lxcManagedTag(file string) string {
+	name := strings.ToLower(strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)))
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' || r == '.' {
+			return r
+		}
+		return '-'
+	}, name)
+	return "infractl-" + name
+}
+
+// addLxcTag adds tag to a semicolon separated tag list unless it is already there.
+func addLxcTag(tags string, tag string) string {
+	if tag == "" {
+		return tags
+	}
+	list := strings.FieldsFunc(tags, func(r rune) bool { return r == ';' || r == ',' || r == ' ' })
+	if !slices.Contains(list, tag) {
+		list = append(list, tag)
+	}
+	return strings.Join(list, ";")
+}
@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
 
+	"github.com/babbage88/infra-cli/provision"
 	"github.com/babbage88/infra-cli/proxmox"
 	"github.com/goccy/go-yaml"
 	"github.com/spf13/cobra"
@@ -15,6 +18,16 @@ var createBatchCmd = &cobra.Command{
 	Use:     "create-batch",
 	Aliases: []string{"create-lxc-batch", "batch"},
 	Short:   "Create multiple LXC containers from a YAML file",
+	Long: `Create multiple LXC containers from a YAML list of containers. Entries whose container already
+exists, matched by vmid or by hostname when there is none, are skipped.
+
+Containers are created one at a time unless --parallel allows more. --per-node limits how many are
+created at once on the same node, since Proxmox serializes some storage operations. The batch stops
+starting new containers after the first failure unless --continue-on-error is set.
+
+A table of every entry's outcome (created, skipped or failed with the reason) and how long it took
+is printed at the end, or a JSON list with -o json, in which case progress goes to stderr. The exit
+status is non-zero only when an entry failed.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Load configuration
 		localViper := viper.New()
@@ -25,39 +38,228 @@ var createBatchCmd = &cobra.Command{
 				log.Fatalf("Failed to load config: %v", err)
 			}
 		}
+		bindLocalFlags(cmd, localViper)
+
+		output := localViper.GetString("output")
+		if output != "" && output != "table" && output != "json" {
+			log.Fatalf("Invalid --output %q, expected table or json", output)
+		}
+		schedule := batchSchedule{
+			Parallel:        localViper.GetInt("parallel"),
+			PerNode:         localViper.GetInt("per_node"),
+			ContinueOnError: localViper.GetBool("continue_on_error"),
+		}
+		// Keep stdout for the JSON result. Task logs of containers created in parallel would be
+		// interleaved without telling which container they belong to, so they are dropped.
+		var progress io.Writer = os.Stdout
+		if output == "json" {
+			progress = os.Stderr
+			logToStderr()
+		}
+		taskOutput := progress
+		if schedule.Parallel > 1 {
+			taskOutput = nil
+		}
 
 		// Read the YAML file containing the batch of containers
 		filePath, _ := cmd.Flags().GetString("file")
-		if filePath == "" {
-			log.Fatal("No YAML file provided")
+		entries, err := loadLxcBatchFile(filePath)
+		if err != nil {
+			log.Fatal(err)
 		}
 
-		fileContent, err := os.ReadFile(filePath)
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+		client, err := newProxmoxClient(proxmoxAuthFromConfig(localViper), proxmox.WithTaskOutput(taskOutput))
 		if err != nil {
-			log.Fatalf("Failed to read file: %v", err)
+			log.Fatalf("Error creating Proxmox client: %v", err)
 		}
 
-		var lxcContainers []proxmox.LxcContainer
-		if err := yaml.Unmarshal(fileContent, &lxcContainers); err != nil {
-			log.Fatalf("Failed to parse YAML: %v", err)
+		spec, err := prepareLxcBatch(localViper, entries)
+		if err != nil {
+			log.Fatal(err)
+		}
+		guests, err := client.ClusterGuests(ctx)
+		if err != nil {
+			log.Fatalf("Error listing existing containers: %v", err)
 		}
 
-		// Create each container
-		for _, lxc := range lxcContainers {
-			fmt.Printf("Creating LXC container %d...\n", lxc.VmId)
-			fmt.Printf("SshPublicKeys: %s\n", lxc.SshPublicKeys)
-			err := proxmox.CreateLXCContainer(localViper.GetString("host_url"), localViper.GetString("api_token"), lxc.Node, lxc.ToFormParams())
-			if err != nil {
-				log.Fatalf("Error creating container: %v", err)
+		// Skip entries that already exist, then allocate VMIDs for the rest.
+		results := make([]*batchResult, len(entries))
+		var vmids []batchVmId
+		for i := range entries {
+			entry := &entries[i]
+			guest, found, err := matchLxcEntry(guests, entry.LxcContainer)
+			switch {
+			case err != nil:
+				results[i] = &batchResult{Name: entry.Hostname, VmId: entry.VmId, Node: entry.Node, Status: "failed", Reason: err.Error()}
+			case found:
+				results[i] = &batchResult{Name: entry.Hostname, VmId: guest.VmId, Node: guest.Node, Status: "skipped",
+					Reason: fmt.Sprintf("already exists as CT %d on %s", guest.VmId, guest.Node)}
+			default:
+				vmids = append(vmids, batchVmId{Name: entry.Hostname, Pool: entry.Pool, VmId: &entry.VmId})
 			}
-			fmt.Println("Container created successfully")
+		}
+		if err := allocateBatchVmIds(ctx, client, localViper, vmids, progress); err != nil {
+			log.Fatal(err)
+		}
+
+		for i, entry := range entries {
+			if results[i] == nil {
+				results[i] = &batchResult{Name: entry.Hostname, VmId: entry.VmId, Node: entry.Node}
+			}
+		}
+		schedule.run(ctx, results, func(ctx context.Context, i int, out io.Writer) error {
+			return createLxcBatchEntry(ctx, client, entries[i], spec, out)
+		}, progress)
+		if err := printBatchResults(results, output, "container(s)"); err != nil {
+			log.Fatal(err)
 		}
 	},
 }
 
+// lxcBatchEntry is one container in a create-batch file. Besides the container settings an
+// entry can name a DNS record to point at the container once it is up.
+type lxcBatchEntry struct {
+	proxmox.LxcContainer `yaml:",inline"`
+	DnsRecord            string `yaml:"dns_record,omitempty"`
+
+	dns *lxcDnsRecord // resolved from DnsRecord by prepareLxcBatch
+}
+
+// loadLxcBatchFile reads the list of containers in a create-batch or apply file.
+func loadLxcBatchFile(path string) ([]lxcBatchEntry, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no YAML file provided")
+	}
+	fileContent, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	var entries []lxcBatchEntry
+	if err := yaml.Unmarshal(fileContent, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	return entries, nil
+}
+
+// prepareLxcBatch validates every entry and loads the --provision file. Entries that will be
+// provisioned or get a DNS record are set to start, and carry the DNS marker in their description.
+func prepareLxcBatch(vp *viper.Viper, entries []lxcBatchEntry) (*provision.Spec, error) {
+	spec, err := loadProvisionSpec(vp)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entry := &entries[i]
+		if err := entry.Validate(); err != nil {
+			return nil, err
+		}
+		if entry.dns, err = lxcDnsRecordFromConfig(vp, entry.DnsRecord); err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Hostname, err)
+		}
+		if spec == nil && entry.dns == nil {
+			continue
+		}
+		if entry.Start == "0" {
+			return nil, fmt.Errorf("%s: --provision and dns_record need the container to be started, remove start: \"0\"", entry.Hostname)
+		}
+		entry.Start = "1"
+		if entry.dns != nil {
+			if _, err := cloudflareDnsToken(); err != nil {
+				return nil, err
+			}
+			addLxcDnsMarker(&entry.LxcContainer, *entry.dns)
+		}
+	}
+	return spec, nil
+}
+
+// createLxcBatchEntry creates the container of a prepared entry, then registers its DNS record
+// and provisions it with spec when those are set.
+func createLxcBatchEntry(ctx context.Context, client *proxmox.Client, entry lxcBatchEntry, spec *provision.Spec, out io.Writer) error {
+	lxc := entry.LxcContainer
+	fmt.Fprintf(out, "Creating LXC container %d...\n", lxc.VmId)
+	upid, err := client.CreateLxc(ctx, lxc.Node, lxc.ToFormParams())
+	if err != nil {
+		return fmt.Errorf("error creating container: %w", err)
+	}
+	if _, err := client.WaitForTask(ctx, lxc.Node, upid); err != nil {
+		return fmt.Errorf("error creating container: %w", err)
+	}
+	fmt.Fprintf(out, "Container %d created successfully\n", lxc.VmId)
+
+	if entry.dns != nil {
+		if err := registerLxcDns(ctx, client, lxc, *entry.dns, out); err != nil {
+			return fmt.Errorf("error registering DNS for container %d: %w", lxc.VmId, err)
+		}
+	}
+	if spec != nil {
+		if err := provisionLxc(ctx, client, lxc, spec, out); err != nil {
+			return fmt.Errorf("error provisioning container %d: %w", lxc.VmId, err)
+		}
+		fmt.Fprintf(out, "Container %d provisioned successfully\n", lxc.VmId)
+	}
+	return nil
+}
+
 func init() {
 	proxmoxLxcSubCmd.AddCommand(createBatchCmd)
 
 	createBatchCmd.Flags().StringVar(&configFilePath, "config-file", "", "Path to YAML config file containing proxmox lxc info")
 	createBatchCmd.Flags().String("file", "", "Path to the YAML file containing batch LXC container configuration")
+	createBatchCmd.Flags().String("vmid-range", "", "VMID range for entries without a vmid: a name from vmid_ranges or min-max")
+	createBatchCmd.Flags().String("provision", "", "Provisioning file with steps to run over ssh on every container once it is up")
+	createBatchCmd.Flags().String("dns-zone", "", "Cloudflare zone for entries with a dns_record (default domain_name)")
+	createBatchCmd.Flags().Int("dns-ttl", 120, "TTL for dns_record entries")
+	createBatchCmd.Flags().Bool("force", false, "Replace existing dns_record records that infractl did not create")
+	createBatchCmd.Flags().Int("parallel", 1, "How many containers to create at once")
+	createBatchCmd.Flags().Int("per-node", 1, "How many containers to create at once on the same node, 0 for no limit")
+	createBatchCmd.Flags().Bool("continue-on-error", false, "Keep creating the remaining containers after one fails")
+	createBatchCmd.Flags().StringP("output", "o", "table", "Result format: table or json")
+	addProxmoxTLSFlags(createBatchCmd)
+}
+
+// batchVmId is the VMID of one batch entry, which allocateBatchVmIds fills in when it is 0.
+type batchVmId struct {
+	Name string
+	Pool string
+	VmId *int
+}
+
+// allocateBatchVmIds fills in the VMID of every entry without one. Entries whose pool names a
+// range in vmid_ranges get an ID from that range, the rest from --vmid-range. Explicit VMIDs are
+// reserved first so no two entries end up with the same ID.
+func allocateBatchVmIds(ctx context.Context, client *proxmox.Client, vp *viper.Viper, entries []batchVmId, out io.Writer) error {
+	allocator := client.NewVmIdAllocator()
+	for _, e := range entries {
+		if *e.VmId == 0 {
+			continue
+		}
+		if err := allocator.Reserve(*e.VmId); err != nil {
+			return fmt.Errorf("%s: VMID %d appears more than once in the batch", e.Name, *e.VmId)
+		}
+	}
+
+	ranges := proxmoxVmIdRanges(vp)
+	for _, e := range entries {
+		if *e.VmId != 0 {
+			continue
+		}
+		rangeName := vp.GetString("vmid_range")
+		if _, ok := ranges[e.Pool]; ok && e.Pool != "" {
+			rangeName = e.Pool
+		}
+		vmidRange, err := parseProxmoxVmIdRange(ranges, rangeName)
+		if err != nil {
+			return err
+		}
+		id, err := allocator.Next(ctx, vmidRange)
+		if err != nil {
+			return fmt.Errorf("%s: error allocating VMID: %w", e.Name, err)
+		}
+		*e.VmId = id
+		fmt.Fprintf(out, "Allocated VMID %d for %s (range %s)\n", id, e.Name, vmidRange)
+	}
+	return nil
 }
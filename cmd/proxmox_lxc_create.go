@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"os"
 	"strings"
 
 	"github.com/babbage88/infra-cli/proxmox"
@@ -29,16 +30,18 @@ var proxmoxLxcCreateCmd = &cobra.Command{
 				log.Fatalf("Failed to load config: %v", err)
 			}
 		}
-		fmt.Println("DEBUG: Viper config loaded:", localViper.AllSettings())
 
 		// Step 2: Bind flags AFTER config is loaded
 		bindLocalFlags(cmd, localViper)
 
 		// Bind vp. values into the struct manually
-		proxmoxLxcAuth.Host = localViper.GetString("host_url")
-		proxmoxLxcAuth.ApiToken = localViper.GetString("api_token")
+		proxmoxLxcAuth = proxmoxAuthFromConfig(localViper)
 
-		newLxcRequest.VmId = localViper.GetInt("vmid")
+		vmid, err := parseVmIdFlag(localViper.GetString("vmid"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		newLxcRequest.VmId = vmid
 		newLxcRequest.Hostname = localViper.GetString("lxc_hostname")
 		newLxcRequest.Node = localViper.GetString("pve_node")
 		newLxcRequest.Password = localViper.GetString("lxc_password")
@@ -50,7 +53,30 @@ var proxmoxLxcCreateCmd = &cobra.Command{
 		newLxcRequest.Cores = localViper.GetInt("cores")
 		newLxcRequest.CpuLimit = localViper.GetInt("cpu_limit")
 		newLxcRequest.CpuUnits = localViper.GetInt("cpu_units")
-		newLxcRequest.Net0 = localViper.GetString("net0")
+		newLxcRequest.Bridge = localViper.GetString("bridge")
+		newLxcRequest.Nameserver = localViper.GetString("nameserver")
+		newLxcRequest.Searchdomain = localViper.GetString("searchdomain")
+		newLxcRequest.Pool = localViper.GetString("pool")
+		newLxcRequest.Description = localViper.GetString("description")
+		newLxcRequest.Tags = strings.Join(localViper.GetStringSlice("tags"), ";")
+		newLxcRequest.Features = localViper.GetString("features")
+		newLxcRequest.Startup = localViper.GetString("startup")
+		newLxcRequest.BwLimit = localViper.GetInt("bwlimit")
+		if localViper.GetBool("debug") {
+			newLxcRequest.Debug = 1
+		}
+
+		// Structured networks and mount points only come from the config file. The net0 flag
+		// default is dropped when networks are configured there.
+		if err := unmarshalViperKey(localViper, "networks", &newLxcRequest.Networks); err != nil {
+			log.Fatalf("Invalid networks in config: %v", err)
+		}
+		if err := unmarshalViperKey(localViper, "mountpoints", &newLxcRequest.MountPoints); err != nil {
+			log.Fatalf("Invalid mountpoints in config: %v", err)
+		}
+		if len(newLxcRequest.Networks) == 0 || localViper.IsSet("net0") {
+			newLxcRequest.Net0 = localViper.GetString("net0")
+		}
 
 		newLxcRequest.Arch = localViper.GetString("arch")
 		newLxcRequest.Cmode = localViper.GetString("cmode")
@@ -74,14 +100,80 @@ var proxmoxLxcCreateCmd = &cobra.Command{
 		}
 
 		newLxcRequest.SshPublicKeys = localViper.GetStringSlice("ssh_public_keys")
+		for _, keyFile := range localViper.GetStringSlice("ssh_public_key_files") {
+			keyBytes, err := os.ReadFile(keyFile)
+			if err != nil {
+				log.Fatalf("Failed to read ssh public key file %s: %v", keyFile, err)
+			}
+			newLxcRequest.SshPublicKeys = append(newLxcRequest.SshPublicKeys, strings.TrimSpace(string(keyBytes)))
+		}
+
+		if err := newLxcRequest.Validate(); err != nil {
+			log.Fatal(err)
+		}
+		spec, err := loadProvisionSpec(localViper)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if spec != nil && newLxcRequest.Start != "1" {
+			log.Fatal("--provision needs the container to be started, drop --start=false")
+		}
+		dnsRecord, err := lxcDnsRecordFromConfig(localViper, localViper.GetString("dns_record"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if dnsRecord != nil {
+			if newLxcRequest.Start != "1" {
+				log.Fatal("--dns-record needs the container to be started, drop --start=false")
+			}
+			if _, err := cloudflareDnsToken(); err != nil {
+				log.Fatal(err)
+			}
+			addLxcDnsMarker(&newLxcRequest, *dnsRecord)
+		}
+
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+		client, err := newProxmoxClient(proxmoxLxcAuth)
+		if err != nil {
+			log.Fatalf("Error creating Proxmox client: %v", err)
+		}
+
+		if newLxcRequest.VmId == 0 {
+			vmidRange, err := parseProxmoxVmIdRange(proxmoxVmIdRanges(localViper), localViper.GetString("vmid_range"))
+			if err != nil {
+				log.Fatal(err)
+			}
+			newLxcRequest.VmId, err = client.NewVmIdAllocator().Next(ctx, vmidRange)
+			if err != nil {
+				log.Fatalf("Error allocating VMID: %v", err)
+			}
+			fmt.Printf("Allocated VMID %d (range %s)\n", newLxcRequest.VmId, vmidRange)
+		}
 
 		fmt.Println("Creating LXC container...")
 		params := newLxcRequest.ToFormParams()
-		err := proxmox.CreateLXCContainer(proxmoxLxcAuth.Host, proxmoxLxcAuth.ApiToken, newLxcRequest.Node, params)
+		upid, err := client.CreateLxc(ctx, newLxcRequest.Node, params)
 		if err != nil {
 			log.Fatalf("Error creating container: %v", err)
 		}
-		fmt.Println("Container creation request sent successfully.")
+		if _, err := client.WaitForTask(ctx, newLxcRequest.Node, upid); err != nil {
+			log.Fatalf("Error creating container: %v", err)
+		}
+		fmt.Printf("Container %d created successfully.\n", newLxcRequest.VmId)
+
+		if dnsRecord != nil {
+			if err := registerLxcDns(ctx, client, newLxcRequest, *dnsRecord, os.Stdout); err != nil {
+				log.Fatalf("Error registering DNS for container %d: %v", newLxcRequest.VmId, err)
+			}
+		}
+
+		if spec != nil {
+			if err := provisionLxc(ctx, client, newLxcRequest, spec, os.Stdout); err != nil {
+				log.Fatalf("Error provisioning container %d: %v", newLxcRequest.VmId, err)
+			}
+			fmt.Printf("Container %d provisioned successfully.\n", newLxcRequest.VmId)
+		}
 	},
 }
 
@@ -93,14 +185,17 @@ func init() {
 	// Auth flags
 	proxmoxLxcCreateCmd.Flags().String("host-url", "", "Proxmox host URL")
 	proxmoxLxcCreateCmd.Flags().String("api-token", "", "Proxmox API token")
+	addProxmoxTLSFlags(proxmoxLxcCreateCmd)
 
 	// LXC flags
-	proxmoxLxcCreateCmd.Flags().Int("vmid", 9090, "Container VM ID")
+	proxmoxLxcCreateCmd.Flags().String("vmid", "auto", "Container VM ID, or auto for the next free one")
+	proxmoxLxcCreateCmd.Flags().String("vmid-range", "", "VMID range for --vmid auto: a name from vmid_ranges (e.g. a pool or environment) or min-max")
 	proxmoxLxcCreateCmd.Flags().String("pve-node", "", "Proxmox node name")
 	proxmoxLxcCreateCmd.Flags().String("lxc-hostname", "", "Hostname for new lxc container")
 	proxmoxLxcCreateCmd.Flags().String("lxc-password", "", "Container root password")
 	proxmoxLxcCreateCmd.Flags().String("ostemplate", "local:vztmpl/debian-12-standard_12.7-1_amd64.tar.zst", "OS template")
 	proxmoxLxcCreateCmd.Flags().StringSlice("ssh-public-keys", nil, "Authorized SSH public keys")
+	proxmoxLxcCreateCmd.Flags().StringSlice("ssh-public-key-files", nil, "Files containing authorized SSH public keys, e.g. output of 'ssh keygen'")
 	proxmoxLxcCreateCmd.Flags().String("storage", "local-lvm", "Storage for container")
 	proxmoxLxcCreateCmd.Flags().String("rootfs-size", "9", "Root filesystem size in GB")
 	proxmoxLxcCreateCmd.Flags().Int("memory", 1024, "Memory in MB")
@@ -108,10 +203,25 @@ func init() {
 	proxmoxLxcCreateCmd.Flags().Int("cores", 1, "CPU cores")
 	proxmoxLxcCreateCmd.Flags().Int("cpu-limit", 0, "CPU limit")
 	proxmoxLxcCreateCmd.Flags().Int("cpu-units", 1024, "CPU weight")
-	proxmoxLxcCreateCmd.Flags().String("net0", "name=eth0,bridge=vmbr0,ip=dhcp,type=veth", "Network config")
+	proxmoxLxcCreateCmd.Flags().String("net0", "name=eth0,bridge=vmbr0,ip=dhcp,type=veth", "Network config, ignored when networks are set in the config file")
+	proxmoxLxcCreateCmd.Flags().String("bridge", "", "Default bridge for networks in the config file that do not set one")
+	proxmoxLxcCreateCmd.Flags().String("nameserver", "", "DNS server IP addresses, space separated")
+	proxmoxLxcCreateCmd.Flags().String("searchdomain", "", "DNS search domains")
+	proxmoxLxcCreateCmd.Flags().String("pool", "", "Resource pool to add the container to")
+	proxmoxLxcCreateCmd.Flags().String("description", "", "Container description shown in the Proxmox UI")
+	proxmoxLxcCreateCmd.Flags().StringSlice("tags", nil, "Proxmox tags")
+	proxmoxLxcCreateCmd.Flags().String("features", "", "Container features, e.g. nesting=1,keyctl=1")
+	proxmoxLxcCreateCmd.Flags().String("startup", "", "Startup and shutdown order, e.g. order=1,up=30")
+	proxmoxLxcCreateCmd.Flags().Int("bwlimit", 0, "I/O bandwidth limit for creating the container in KiB/s")
+	proxmoxLxcCreateCmd.Flags().Bool("debug", false, "Start the container with debug logging")
 	proxmoxLxcCreateCmd.Flags().Bool("unprivileged", true, "Use unprivileged container")
 	proxmoxLxcCreateCmd.Flags().Bool("start", true, "Start after create")
 	proxmoxLxcCreateCmd.Flags().Bool("console", true, "Attach console")
+	proxmoxLxcCreateCmd.Flags().String("provision", "", "Provisioning file with steps to run over ssh once the container is up")
+	proxmoxLxcCreateCmd.Flags().String("dns-record", "", "Create or update an A/AAAA record with this name pointing at the container's IP")
+	proxmoxLxcCreateCmd.Flags().String("dns-zone", "", "Cloudflare zone for --dns-record (default domain_name)")
+	proxmoxLxcCreateCmd.Flags().Int("dns-ttl", 120, "TTL for --dns-record")
+	proxmoxLxcCreateCmd.Flags().Bool("force", false, "Replace an existing --dns-record that infractl did not create")
 
 }
 
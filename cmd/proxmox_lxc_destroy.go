@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/babbage88/infra-cli/proxmox"
+	"github.com/spf13/cobra"
+)
+
+var proxmoxLxcDestroyCmd = &cobra.Command{
+	Use:     "destroy <vmid|name>...",
+	Aliases: []string{"delete", "rm"},
+	Short:   "Destroy LXC containers and their volumes",
+	Long: `Destroy LXC containers and their volumes after asking for confirmation. Running containers are
+shut down first as with stop. --purge also removes them from backup jobs, replication and HA.
+DNS records added with create --dns-record are removed from Cloudflare afterwards.`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		purge, _ := cmd.Flags().GetBool("purge")
+		yes, _ := cmd.Flags().GetBool("yes")
+		opts := lxcStopOptionsFromFlags(cmd)
+
+		if !yes && !confirm(fmt.Sprintf("Destroy %d container(s) %v and all their data?", len(args), args)) {
+			return fmt.Errorf("aborted")
+		}
+		return runLxcAction(cmd, args, "destroyed", func(ctx context.Context, client *proxmox.Client, ct proxmox.Guest) error {
+			return destroyLxc(ctx, client, ct, opts, purge)
+		})
+	},
+}
+
+func init() {
+	proxmoxLxcSubCmd.AddCommand(proxmoxLxcDestroyCmd)
+
+	addProxmoxConnFlags(proxmoxLxcDestroyCmd)
+	addLxcStopFlags(proxmoxLxcDestroyCmd)
+	proxmoxLxcDestroyCmd.Flags().Bool("purge", false, "Also remove the containers from backup jobs, replication and HA")
+	proxmoxLxcDestroyCmd.Flags().BoolP("yes", "y", false, "Destroy without asking for confirmation")
+}
+
+// destroyLxc stops ct as stop would and destroys it, then removes the DNS records create
+// registered for it.
+func destroyLxc(ctx context.Context, client *proxmox.Client, ct proxmox.Guest, opts lxcStopOptions, purge bool) error {
+	// DNS records registered by create are listed in the description, which is gone after the
+	// delete, so read them first and remove them once the container is destroyed.
+	records, err := lxcDnsRecords(ctx, client, ct)
+	if err != nil {
+		return fmt.Errorf("error reading container config: %w", err)
+	}
+	if err := stopLxc(ctx, client, ct, opts); err != nil {
+		return fmt.Errorf("error stopping container: %w", err)
+	}
+	if err := waitForTaskResult(ctx, client, ct.Node)(client.DeleteLxc(ctx, ct.Node, ct.VmId, purge)); err != nil {
+		return err
+	}
+	if err := unregisterLxcDns(ctx, ct.VmId, records); err != nil {
+		return fmt.Errorf("container destroyed but DNS cleanup failed: %w", err)
+	}
+	return nil
+}
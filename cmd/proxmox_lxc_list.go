@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/babbage88/infra-cli/proxmox"
+	"github.com/spf13/cobra"
+)
+
+var proxmoxLxcListCmd = &cobra.Command{
+	Use:          "list",
+	Aliases:      []string{"ls"},
+	Short:        "List LXC containers on all nodes with their status, usage, tags and IPs",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := proxmoxClientFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+
+		guests, err := client.ClusterGuests(ctx)
+		if err != nil {
+			return err
+		}
+		node, _ := cmd.Flags().GetString("pve-node")
+		containers := make([]proxmox.Guest, 0, len(guests))
+		for _, g := range guests {
+			if g.Type == "lxc" && !g.Template && (node == "" || g.Node == node) {
+				containers = append(containers, g)
+			}
+		}
+		client.FillGuestAddresses(ctx, containers)
+
+		if output, _ := cmd.Flags().GetString("output"); output == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(containers)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VMID\tNAME\tNODE\tSTATUS\tCPU\tMEMORY\tUPTIME\tTAGS\tIPS")
+		for _, c := range containers {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", c.VmId, c.Name, c.Node, c.Status,
+				formatCpuUsage(c.Cpu, c.MaxCpu), formatMemUsage(c.Mem, c.MaxMem), formatUptime(c.Uptime),
+				strings.Join(c.Tags, ","), strings.Join(c.Addresses, ","))
+		}
+		return tw.Flush()
+	},
+}
+
+var proxmoxLxcStatusCmd = &cobra.Command{
+	Use:          "status <vmid|name>",
+	Short:        "Show the live status of an LXC container",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := proxmoxClientFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+
+		guest, err := findLxc(ctx, client, args[0])
+		if err != nil {
+			return err
+		}
+		status, err := client.LxcStatus(ctx, guest.Node, guest.VmId)
+		if err != nil {
+			return err
+		}
+		guest.Addresses = client.GuestAddresses(ctx, guest)
+
+		if output, _ := cmd.Flags().GetString("output"); output == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(struct {
+				proxmox.LxcStatus
+				VmId      int      `json:"vmid"`
+				Node      string   `json:"node"`
+				Addresses []string `json:"addresses,omitempty"`
+			}{*status, guest.VmId, guest.Node, guest.Addresses})
+		}
+		fmt.Printf("VMID:    %d\nName:    %s\nNode:    %s\nStatus:  %s\n", guest.VmId, status.Name, guest.Node, status.Status)
+		if status.Lock != "" {
+			fmt.Printf("Lock:    %s\n", status.Lock)
+		}
+		fmt.Printf("Uptime:  %s\nCPU:     %s\nMemory:  %s\nSwap:    %s\nDisk:    %s\n",
+			formatUptime(status.Uptime), formatCpuUsage(status.Cpu, status.Cpus), formatMemUsage(status.Mem, status.MaxMem),
+			formatMemUsage(status.Swap, status.MaxSwap), formatMemUsage(status.Disk, status.MaxDisk))
+		fmt.Printf("Tags:    %s\nIPs:     %s\n", strings.Join(guest.Tags, ","), strings.Join(guest.Addresses, ","))
+		return nil
+	},
+}
+
+func init() {
+	proxmoxLxcSubCmd.AddCommand(proxmoxLxcListCmd, proxmoxLxcStatusCmd)
+
+	addProxmoxConnFlags(proxmoxLxcListCmd)
+	proxmoxLxcListCmd.Flags().String("pve-node", "", "Only list containers on this node")
+	proxmoxLxcListCmd.Flags().StringP("output", "o", "", "Set to json for machine readable output")
+
+	addProxmoxConnFlags(proxmoxLxcStatusCmd)
+	proxmoxLxcStatusCmd.Flags().StringP("output", "o", "", "Set to json for machine readable output")
+}
+
+func formatCpuUsage(cpu, cpus float64) string {
+	if cpus == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%% of %g", cpu*100, cpus)
+}
+
+func formatMemUsage(used, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%s/%s", formatBytes(used), formatBytes(total))
+}
+
+func formatUptime(seconds int64) string {
+	if seconds == 0 {
+		return "-"
+	}
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/babbage88/infra-cli/internal/pretty"
+	"github.com/babbage88/infra-cli/proxmox"
+	"github.com/spf13/cobra"
+)
+
+var proxmoxLxcStartCmd = &cobra.Command{
+	Use:          "start <vmid|name>...",
+	Short:        "Start LXC containers",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runLxcAction(cmd, args, "started", func(ctx context.Context, client *proxmox.Client, ct proxmox.Guest) error {
+			if ct.Status == "running" {
+				return nil
+			}
+			return waitForTaskResult(ctx, client, ct.Node)(client.StartLxc(ctx, ct.Node, ct.VmId))
+		})
+	},
+}
+
+var proxmoxLxcStopCmd = &cobra.Command{
+	Use:   "stop <vmid|name>...",
+	Short: "Shut LXC containers down, hard stopping any still running after --timeout",
+	Long: `Shut LXC containers down cleanly through their init. Containers still running after --timeout
+are stopped hard unless --no-force is set; --hard skips the clean shutdown.`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := lxcStopOptionsFromFlags(cmd)
+		return runLxcAction(cmd, args, "stopped", func(ctx context.Context, client *proxmox.Client, ct proxmox.Guest) error {
+			return stopLxc(ctx, client, ct, opts)
+		})
+	},
+}
+
+var proxmoxLxcRebootCmd = &cobra.Command{
+	Use:          "reboot <vmid|name>...",
+	Short:        "Reboot LXC containers",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		return runLxcAction(cmd, args, "rebooted", func(ctx context.Context, client *proxmox.Client, ct proxmox.Guest) error {
+			if ct.Status != "running" {
+				return fmt.Errorf("container is %s", ct.Status)
+			}
+			return waitForTaskResult(ctx, client, ct.Node)(client.RebootLxc(ctx, ct.Node, ct.VmId, timeout))
+		})
+	},
+}
+
+func init() {
+	proxmoxLxcSubCmd.AddCommand(proxmoxLxcStartCmd, proxmoxLxcStopCmd, proxmoxLxcRebootCmd)
+
+	addProxmoxConnFlags(proxmoxLxcStartCmd)
+
+	addProxmoxConnFlags(proxmoxLxcStopCmd)
+	addLxcStopFlags(proxmoxLxcStopCmd)
+
+	addProxmoxConnFlags(proxmoxLxcRebootCmd)
+	proxmoxLxcRebootCmd.Flags().Duration("timeout", 60*time.Second, "How long to wait for the container to shut down before rebooting")
+}
+
+// lxcStopOptions controls stopLxc.
+type lxcStopOptions struct {
+	Timeout time.Duration // how long a clean shutdown may take
+	Hard    bool          // skip the clean shutdown
+	NoForce bool          // fail instead of hard stopping when the shutdown times out
+}
+
+func addLxcStopFlags(cmd *cobra.Command) {
+	cmd.Flags().Duration("timeout", 60*time.Second, "How long to wait for a clean shutdown")
+	cmd.Flags().Bool("hard", false, "Stop immediately without a clean shutdown")
+	cmd.Flags().Bool("no-force", false, "Fail instead of hard stopping containers that do not shut down within --timeout")
+}
+
+func lxcStopOptionsFromFlags(cmd *cobra.Command) lxcStopOptions {
+	var opts lxcStopOptions
+	opts.Timeout, _ = cmd.Flags().GetDuration("timeout")
+	opts.Hard, _ = cmd.Flags().GetBool("hard")
+	opts.NoForce, _ = cmd.Flags().GetBool("no-force")
+	return opts
+}
+
+// stopLxc shuts ct down cleanly and falls back to a hard stop when the shutdown fails or times out.
+func stopLxc(ctx context.Context, client *proxmox.Client, ct proxmox.Guest, opts lxcStopOptions) error {
+	if ct.Status == "stopped" {
+		return nil
+	}
+	if !opts.Hard {
+		err := waitForTaskResult(ctx, client, ct.Node)(client.ShutdownLxc(ctx, ct.Node, ct.VmId, opts.Timeout))
+		var taskErr proxmox.TaskError
+		if err == nil || opts.NoForce || !errors.As(err, &taskErr) {
+			return err
+		}
+		pretty.PrintWarningf("[%d] clean shutdown failed (%v), stopping hard", ct.VmId, err)
+	}
+	return waitForTaskResult(ctx, client, ct.Node)(client.StopLxc(ctx, ct.Node, ct.VmId))
+}
+
+// findLxc looks ct up by VMID or name and checks it is a container.
+func findLxc(ctx context.Context, client *proxmox.Client, ref string) (proxmox.Guest, error) {
+	guest, err := client.FindGuest(ctx, ref)
+	if err != nil {
+		return proxmox.Guest{}, err
+	}
+	if guest.Type != "lxc" {
+		return proxmox.Guest{}, fmt.Errorf("%s is a %s guest, not an LXC container", ref, guest.Type)
+	}
+	return guest, nil
+}
+
+// runLxcAction resolves each container argument and runs action on it in turn, reporting each
+// result and returning an error if any failed.
+func runLxcAction(cmd *cobra.Command, refs []string, done string, action func(context.Context, *proxmox.Client, proxmox.Guest) error) error {
+	client, err := proxmoxClientFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	ctx, stop := interruptContext(cmd)
+	defer stop()
+
+	failed := 0
+	for _, ref := range refs {
+		ct, err := findLxc(ctx, client, ref)
+		if err == nil {
+			err = action(ctx, client, ct)
+		}
+		if err != nil {
+			pretty.PrintErrorf("[%s] %v", ref, err)
+			failed++
+			continue
+		}
+		pretty.Printf("[%d %s] %s", ct.VmId, ct.Name, done)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d container(s) failed", failed, len(refs))
+	}
+	return nil
+}
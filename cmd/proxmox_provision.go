@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/babbage88/infra-cli/provision"
+	"github.com/babbage88/infra-cli/proxmox"
+	"github.com/babbage88/infra-cli/ssh"
+	"github.com/spf13/viper"
+)
+
+// loadProvisionSpec loads the provisioning file named by the provision key (--provision), or
+// returns nil when there is none.
+func loadProvisionSpec(vp *viper.Viper) (*provision.Spec, error) {
+	path := vp.GetString("provision")
+	if path == "" {
+		return nil, nil
+	}
+	return provision.Load(expandHome(path))
+}
+
+// provisionLxc waits for a container that was just created and started to get an address and
+// answer ssh, then connects with the key matching the injected public key and runs spec.
+func provisionLxc(ctx context.Context, client *proxmox.Client, lxc proxmox.LxcContainer, spec *provision.Spec, out io.Writer) error {
+	timeout := spec.Timeout()
+	fmt.Fprintf(out, "Waiting for container %d to get an IP address...\n", lxc.VmId)
+	addr, err := client.WaitForLxcAddress(ctx, lxc.Node, lxc.VmId, timeout)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Container %d is at %s, waiting for ssh...\n", lxc.VmId, addr)
+	if err := provision.WaitForSsh(ctx, net.JoinHostPort(addr, "22"), timeout); err != nil {
+		return err
+	}
+
+	key := rootViperCfg.GetString("ssh_key")
+	if spec.SshKey != "" {
+		key = expandHome(spec.SshKey)
+	}
+	agent, err := ssh.NewRemoteAppDeploymentAgentForNewHost(addr, spec.SshUser(), key,
+		rootViperCfg.GetString("ssh_passphrase"), rootViperCfg.GetBool("ssh_use_agent"), 22)
+	if err != nil {
+		return fmt.Errorf("error connecting to container %d at %s: %w", lxc.VmId, addr, err)
+	}
+	defer agent.Close()
+	agent.SudoPassword = sudoPasswordSource()
+
+	return spec.Run(ctx, agent, out)
+}
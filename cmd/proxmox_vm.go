@@ -0,0 +1,13 @@
+package cmd
+
+import "github.com/spf13/cobra"
+
+var proxmoxVmSubCmd = &cobra.Command{
+	Use:     "vm",
+	Aliases: []string{"qemu"},
+	Short:   "Commands for creation and management of QEMU virtual machines",
+}
+
+func init() {
+	proxmoxSubCmd.AddCommand(proxmoxVmSubCmd)
+}
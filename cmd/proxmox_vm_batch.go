@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/babbage88/infra-cli/proxmox"
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var proxmoxVmBatchCmd = &cobra.Command{
+	Use:     "create-batch",
+	Aliases: []string{"create-vm-batch", "batch"},
+	Short:   "Create multiple VMs from templates listed in a YAML file",
+	Long: `Create multiple VMs from a YAML list with the same fields as create, for example:
+
+  - name: web1
+    template: debian-12-cloud
+    cores: 2
+    memory: 4096
+    disks: [{name: scsi0, size: 32G}]
+    networks: [{bridge: vmbr0, tag: 20}]
+    cloud_init:
+      user: debian
+      ssh_public_keys: ["ssh-ed25519 AAAA..."]
+      ipconfigs: [{ip: 10.0.20.11/24, gw: 10.0.20.1}]
+
+Entries whose VM already exists, matched by vmid or by name when there is none, are skipped.
+Entries without a vmid get one from their pool's range in vmid_ranges or --vmid-range. The guest
+agent is enabled and the VM started unless the entry sets agent or start to "0".
+
+VMs are created one at a time. The batch stops starting new VMs after the first failure unless
+--continue-on-error is set. A table of every entry's outcome (created, skipped or failed with the
+reason) and how long it took is printed at the end, or a JSON list with -o json, in which case
+progress goes to stderr. The exit status is non-zero only when an entry failed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		localViper := viper.New()
+		if cfgFile, _ := cmd.Flags().GetString("config-file"); cfgFile != "" {
+			if err := loadProxmoxConfigFile(expandHome(cfgFile), localViper); err != nil {
+				log.Fatalf("Failed to load config: %v", err)
+			}
+		}
+		bindLocalFlags(cmd, localViper)
+
+		output := localViper.GetString("output")
+		if output != "" && output != "table" && output != "json" {
+			log.Fatalf("Invalid --output %q, expected table or json", output)
+		}
+		var progress io.Writer = os.Stdout
+		if output == "json" {
+			progress = os.Stderr
+			logToStderr()
+		}
+
+		filePath, _ := cmd.Flags().GetString("file")
+		if filePath == "" {
+			log.Fatal("No YAML file provided")
+		}
+		fileContent, err := os.ReadFile(filePath)
+		if err != nil {
+			log.Fatalf("Failed to read file: %v", err)
+		}
+		var vms []proxmox.QemuVm
+		if err := yaml.Unmarshal(fileContent, &vms); err != nil {
+			log.Fatalf("Failed to parse YAML: %v", err)
+		}
+
+		for i := range vms {
+			if vms[i].Agent == "" {
+				vms[i].Agent = "1"
+			}
+			if err := vms[i].Validate(); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+		client, err := newProxmoxClient(proxmoxAuthFromConfig(localViper), proxmox.WithTaskOutput(progress))
+		if err != nil {
+			log.Fatalf("Error creating Proxmox client: %v", err)
+		}
+		guests, err := client.ClusterGuests(ctx)
+		if err != nil {
+			log.Fatalf("Error listing existing VMs: %v", err)
+		}
+
+		// Skip entries that already exist, then allocate VMIDs for the rest.
+		results := make([]*batchResult, len(vms))
+		var vmids []batchVmId
+		for i := range vms {
+			vm := &vms[i]
+			guest, found, err := matchQemuEntry(guests, *vm)
+			switch {
+			case err != nil:
+				results[i] = &batchResult{Name: vm.Name, VmId: vm.VmId, Node: vm.Node, Status: "failed", Reason: err.Error()}
+			case found:
+				results[i] = &batchResult{Name: vm.Name, VmId: guest.VmId, Node: guest.Node, Status: "skipped",
+					Reason: fmt.Sprintf("already exists as VM %d on %s", guest.VmId, guest.Node)}
+			default:
+				vmids = append(vmids, batchVmId{Name: vm.Name, Pool: vm.Pool, VmId: &vm.VmId})
+			}
+		}
+		if err := allocateBatchVmIds(ctx, client, localViper, vmids, progress); err != nil {
+			log.Fatal(err)
+		}
+		for i, vm := range vms {
+			if results[i] == nil {
+				results[i] = &batchResult{Name: vm.Name, VmId: vm.VmId, Node: vm.Node}
+			}
+		}
+
+		schedule := batchSchedule{ContinueOnError: localViper.GetBool("continue_on_error")}
+		waitIp := localViper.GetDuration("wait_ip")
+		schedule.run(ctx, results, func(ctx context.Context, i int, out io.Writer) error {
+			err := createQemuVm(ctx, client, &vms[i], waitIp, out)
+			// The node comes from the template when the entry does not name one.
+			results[i].Node = vms[i].Node
+			return err
+		}, progress)
+		if err := printBatchResults(results, output, "VM(s)"); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// matchQemuEntry finds the existing VM for vm by VMID, or by name when it has none.
+func matchQemuEntry(guests []proxmox.Guest, vm proxmox.QemuVm) (proxmox.Guest, bool, error) {
+	if vm.VmId != 0 {
+		for _, g := range guests {
+			if g.VmId != vm.VmId {
+				continue
+			}
+			if g.Type != "qemu" || g.Template {
+				return g, false, fmt.Errorf("%s: VMID %d is already used by %s %s", vm.Name, vm.VmId, g.Type, g.Name)
+			}
+			return g, true, nil
+		}
+		return proxmox.Guest{}, false, nil
+	}
+
+	var matches []proxmox.Guest
+	for _, g := range guests {
+		if g.Type == "qemu" && !g.Template && g.Name == vm.Name {
+			matches = append(matches, g)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return proxmox.Guest{}, false, nil
+	case 1:
+		return matches[0], true, nil
+	default:
+		return proxmox.Guest{}, false, fmt.Errorf("%s: %d VMs have this name, set the vmid in the file", vm.Name, len(matches))
+	}
+}
+
+func init() {
+	proxmoxVmSubCmd.AddCommand(proxmoxVmBatchCmd)
+
+	addProxmoxConnFlags(proxmoxVmBatchCmd)
+	proxmoxVmBatchCmd.Flags().StringP("file", "f", "", "Path to the YAML file containing the VMs to create")
+	proxmoxVmBatchCmd.Flags().String("vmid-range", "", "VMID range for entries without a vmid: a name from vmid_ranges or min-max")
+	proxmoxVmBatchCmd.Flags().Duration("wait-ip", 5*time.Minute, "How long to wait for each VM's guest agent to report an IP address, 0 to not wait")
+	proxmoxVmBatchCmd.Flags().Bool("continue-on-error", false, "Keep creating the remaining VMs after one fails")
+	proxmoxVmBatchCmd.Flags().StringP("output", "o", "table", "Result format: table or json")
+}
@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/babbage88/infra-cli/proxmox"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var proxmoxVmCreateCmd = &cobra.Command{
+	Use:     "create",
+	Aliases: []string{"new-vm", "clone", "new"},
+	Short:   "Create a VM by cloning a template and configuring it with cloud-init",
+	Long: `Create a VM by cloning a template, then set its CPU, memory, disks, network interfaces and
+cloud-init settings, start it and wait for the QEMU guest agent to report an IP address.
+
+Settings left unset keep the template's values. Disks, networks and ipconfigs can also be given in
+structured form in the config file:
+
+  disks:
+    - {name: scsi0, size: 32G}                 # grow the template's disk
+    - {name: scsi1, storage: local-lvm, size: 100}  # add a 100 GB disk
+  networks:
+    - {bridge: vmbr0, tag: 20}
+  ipconfigs:
+    - {ip: 10.0.20.5/24, gw: 10.0.20.1}`,
+	Run: func(cmd *cobra.Command, args []string) {
+		localViper := viper.New()
+		if cfgFile, _ := cmd.Flags().GetString("config-file"); cfgFile != "" {
+			if err := loadProxmoxConfigFile(expandHome(cfgFile), localViper); err != nil {
+				log.Fatalf("Failed to load config: %v", err)
+			}
+		}
+		bindLocalFlags(cmd, localViper)
+
+		vm, err := qemuVmFromConfig(localViper)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := vm.Validate(); err != nil {
+			log.Fatal(err)
+		}
+
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+		client, err := newProxmoxClient(proxmoxAuthFromConfig(localViper))
+		if err != nil {
+			log.Fatalf("Error creating Proxmox client: %v", err)
+		}
+
+		if vm.VmId == 0 {
+			vmidRange, err := parseProxmoxVmIdRange(proxmoxVmIdRanges(localViper), localViper.GetString("vmid_range"))
+			if err != nil {
+				log.Fatal(err)
+			}
+			vm.VmId, err = client.NewVmIdAllocator().Next(ctx, vmidRange)
+			if err != nil {
+				log.Fatalf("Error allocating VMID: %v", err)
+			}
+			fmt.Printf("Allocated VMID %d (range %s)\n", vm.VmId, vmidRange)
+		}
+
+		if err := createQemuVm(ctx, client, vm, localViper.GetDuration("wait_ip"), os.Stdout); err != nil {
+			log.Fatalf("Error creating VM %d: %v", vm.VmId, err)
+		}
+	},
+}
+
+func init() {
+	proxmoxVmSubCmd.AddCommand(proxmoxVmCreateCmd)
+
+	addProxmoxConnFlags(proxmoxVmCreateCmd)
+
+	proxmoxVmCreateCmd.Flags().String("vmid", "auto", "VM ID, or auto for the next free one")
+	proxmoxVmCreateCmd.Flags().String("vmid-range", "", "VMID range for --vmid auto: a name from vmid_ranges (e.g. a pool or environment) or min-max")
+	proxmoxVmCreateCmd.Flags().String("pve-node", "", "Node to create the VM on (default the template's node)")
+	proxmoxVmCreateCmd.Flags().String("name", "", "VM name, also used as the cloud-init hostname")
+	proxmoxVmCreateCmd.Flags().String("template", "", "VMID or name of the template to clone")
+	proxmoxVmCreateCmd.Flags().Bool("full", false, "Make a full copy instead of a linked clone")
+	proxmoxVmCreateCmd.Flags().String("storage", "", "Target storage for a full clone")
+	proxmoxVmCreateCmd.Flags().String("pool", "", "Resource pool to add the VM to")
+	proxmoxVmCreateCmd.Flags().String("description", "", "VM description shown in the Proxmox UI")
+	proxmoxVmCreateCmd.Flags().StringSlice("tags", nil, "Proxmox tags")
+	proxmoxVmCreateCmd.Flags().Int("cores", 0, "CPU cores per socket")
+	proxmoxVmCreateCmd.Flags().Int("sockets", 0, "CPU sockets")
+	proxmoxVmCreateCmd.Flags().String("cpu-type", "", "CPU type, e.g. host or x86-64-v2-AES")
+	proxmoxVmCreateCmd.Flags().Int("memory", 0, "Memory in MB")
+	proxmoxVmCreateCmd.Flags().Int("balloon", 0, "Minimum memory in MB for ballooning")
+	proxmoxVmCreateCmd.Flags().StringSlice("resize", nil, "Grow template disks, e.g. scsi0=32G")
+	proxmoxVmCreateCmd.Flags().String("bridge", "", "Default bridge for networks in the config file that do not set one")
+	proxmoxVmCreateCmd.Flags().String("ci-user", "", "Cloud-init user")
+	proxmoxVmCreateCmd.Flags().String("ci-password", "", "Cloud-init user password")
+	proxmoxVmCreateCmd.Flags().StringSlice("ssh-public-keys", nil, "Authorized SSH public keys for the cloud-init user")
+	proxmoxVmCreateCmd.Flags().StringSlice("ssh-public-key-files", nil, "Files containing authorized SSH public keys")
+	proxmoxVmCreateCmd.Flags().StringArray("ipconfig", nil, "Cloud-init address for each interface in order, e.g. ip=dhcp or ip=10.0.0.5/24,gw=10.0.0.1")
+	proxmoxVmCreateCmd.Flags().String("nameserver", "", "Cloud-init DNS server IP addresses, space separated")
+	proxmoxVmCreateCmd.Flags().String("searchdomain", "", "Cloud-init DNS search domains")
+	proxmoxVmCreateCmd.Flags().String("ci-drive", "", "Storage to add a cloud-init drive on, for templates without one")
+	proxmoxVmCreateCmd.Flags().String("user-data", "", "Custom cloud-init user-data snippet, e.g. local:snippets/user-data.yaml")
+	proxmoxVmCreateCmd.Flags().String("network-data", "", "Custom cloud-init network-data snippet")
+	proxmoxVmCreateCmd.Flags().String("meta-data", "", "Custom cloud-init meta-data snippet")
+	proxmoxVmCreateCmd.Flags().String("vendor-data", "", "Custom cloud-init vendor-data snippet")
+	proxmoxVmCreateCmd.Flags().Bool("agent", true, "Enable the QEMU guest agent")
+	proxmoxVmCreateCmd.Flags().Bool("onboot", false, "Start the VM when the node boots")
+	proxmoxVmCreateCmd.Flags().Bool("start", true, "Start after create")
+	proxmoxVmCreateCmd.Flags().Duration("wait-ip", 5*time.Minute, "How long to wait for the guest agent to report an IP address, 0 to not wait")
+}
+
+// qemuVmFromConfig builds the VM for create from its flags and config file keys.
+func qemuVmFromConfig(vp *viper.Viper) (*proxmox.QemuVm, error) {
+	vmid, err := parseVmIdFlag(vp.GetString("vmid"))
+	if err != nil {
+		return nil, err
+	}
+	vm := &proxmox.QemuVm{
+		Node:        vp.GetString("pve_node"),
+		VmId:        vmid,
+		Name:        vp.GetString("name"),
+		Template:    vp.GetString("template"),
+		FullClone:   vp.GetBool("full"),
+		Storage:     vp.GetString("storage"),
+		Pool:        vp.GetString("pool"),
+		Description: vp.GetString("description"),
+		Tags:        strings.Join(vp.GetStringSlice("tags"), ";"),
+		Cores:       vp.GetInt("cores"),
+		Sockets:     vp.GetInt("sockets"),
+		CpuType:     vp.GetString("cpu_type"),
+		Memory:      vp.GetInt("memory"),
+		Balloon:     vp.GetInt("balloon"),
+		Bridge:      vp.GetString("bridge"),
+		Agent:       boolParam(vp.GetBool("agent")),
+		Start:       boolParam(vp.GetBool("start")),
+	}
+	if vp.GetBool("onboot") {
+		vm.OnBoot = "1"
+	}
+
+	if err := unmarshalViperKey(vp, "disks", &vm.Disks); err != nil {
+		return nil, fmt.Errorf("invalid disks in config: %w", err)
+	}
+	for _, resize := range vp.GetStringSlice("resize") {
+		disk, size, ok := strings.Cut(resize, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --resize %q, expected disk=size such as scsi0=32G", resize)
+		}
+		vm.Disks = append(vm.Disks, proxmox.QemuDisk{Name: disk, Size: proxmox.DiskSize(size)})
+	}
+	if err := unmarshalViperKey(vp, "networks", &vm.Networks); err != nil {
+		return nil, fmt.Errorf("invalid networks in config: %w", err)
+	}
+
+	ci := &proxmox.QemuCloudInit{
+		User:          vp.GetString("ci_user"),
+		Password:      vp.GetString("ci_password"),
+		SshPublicKeys: vp.GetStringSlice("ssh_public_keys"),
+		Nameserver:    vp.GetString("nameserver"),
+		Searchdomain:  vp.GetString("searchdomain"),
+		Drive:         vp.GetString("ci_drive"),
+		UserData:      vp.GetString("user_data"),
+		NetworkData:   vp.GetString("network_data"),
+		MetaData:      vp.GetString("meta_data"),
+		VendorData:    vp.GetString("vendor_data"),
+	}
+	for _, keyFile := range vp.GetStringSlice("ssh_public_key_files") {
+		keyBytes, err := os.ReadFile(expandHome(keyFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ssh public key file %s: %w", keyFile, err)
+		}
+		ci.SshPublicKeys = append(ci.SshPublicKeys, strings.TrimSpace(string(keyBytes)))
+	}
+	if err := unmarshalViperKey(vp, "ipconfigs", &ci.IpConfigs); err != nil {
+		return nil, fmt.Errorf("invalid ipconfigs in config: %w", err)
+	}
+	for _, ipconfig := range vp.GetStringSlice("ipconfig") {
+		ip, err := parseQemuIpConfig(ipconfig)
+		if err != nil {
+			return nil, err
+		}
+		ci.IpConfigs = append(ci.IpConfigs, ip)
+	}
+	vm.CloudInit = ci
+	return vm, nil
+}
+
+// parseQemuIpConfig parses an --ipconfig value in the Proxmox ipconfigN format.
+func parseQemuIpConfig(value string) (proxmox.QemuIpConfig, error) {
+	var ip proxmox.QemuIpConfig
+	for _, opt := range strings.Split(value, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(opt), "=")
+		switch key {
+		case "ip":
+			ip.Ip = val
+		case "gw":
+			ip.Gateway = val
+		case "ip6":
+			ip.Ip6 = val
+		case "gw6":
+			ip.Gateway6 = val
+		default:
+			return ip, fmt.Errorf("invalid --ipconfig %q, expected ip=, gw=, ip6= and gw6= options", value)
+		}
+	}
+	return ip, nil
+}
+
+func boolParam(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// createQemuVm clones vm from its template, applies its configuration and disk sizes, and starts
+// it unless Start is 0. When the guest agent is enabled and waitIp is not 0 it then waits for the
+// VM to report an IP address. Progress is written to out.
+func createQemuVm(ctx context.Context, client *proxmox.Client, vm *proxmox.QemuVm, waitIp time.Duration, out io.Writer) error {
+	tmpl, err := client.FindGuest(ctx, vm.Template)
+	if err != nil {
+		return err
+	}
+	if tmpl.Type != "qemu" || !tmpl.Template {
+		return fmt.Errorf("%s (%d) is not a VM template", vm.Template, tmpl.VmId)
+	}
+	if vm.Node == "" {
+		vm.Node = tmpl.Node
+	}
+
+	fmt.Fprintf(out, "Cloning template %s (%d) to VM %d on %s...\n", tmpl.Name, tmpl.VmId, vm.VmId, vm.Node)
+	if err := waitForTaskResult(ctx, client, tmpl.Node)(client.CloneVm(ctx, tmpl.Node, tmpl.VmId, vm.CloneParams(tmpl.Node))); err != nil {
+		return fmt.Errorf("error cloning template: %w", err)
+	}
+
+	if params := vm.ConfigParams(); len(params) > 0 {
+		if err := waitForTaskResult(ctx, client, vm.Node)(client.UpdateVmConfig(ctx, vm.Node, vm.VmId, params)); err != nil {
+			return fmt.Errorf("error configuring VM: %w", err)
+		}
+	}
+	resizes := vm.Resizes()
+	for _, disk := range slices.Sorted(maps.Keys(resizes)) {
+		fmt.Fprintf(out, "Resizing %s to %s...\n", disk, resizes[disk])
+		if err := waitForTaskResult(ctx, client, vm.Node)(client.ResizeVmDisk(ctx, vm.Node, vm.VmId, disk, resizes[disk])); err != nil {
+			return fmt.Errorf("error resizing %s: %w", disk, err)
+		}
+	}
+	fmt.Fprintf(out, "VM %d created successfully.\n", vm.VmId)
+
+	if vm.Start == "0" {
+		return nil
+	}
+	if err := waitForTaskResult(ctx, client, vm.Node)(client.StartVm(ctx, vm.Node, vm.VmId)); err != nil {
+		return fmt.Errorf("error starting VM: %w", err)
+	}
+	fmt.Fprintf(out, "VM %d started.\n", vm.VmId)
+
+	if vm.Agent != "1" || waitIp == 0 {
+		return nil
+	}
+	fmt.Fprintf(out, "Waiting for the guest agent of VM %d to report an IP address...\n", vm.VmId)
+	addr, err := client.WaitForVmAddress(ctx, vm.Node, vm.VmId, waitIp)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "VM %d (%s) is up at %s\n", vm.VmId, vm.Name, addr)
+	return nil
+}
@@ -23,6 +23,9 @@ var (
 	sshRemoteTargetUser                     string
 	cpuProfilePath                          string
 	sshUseAgent                             bool
+	askSudoPass                             bool
+	sudoPasswordCmd                         string
+	inventoryPath                           string
 	sshPort                                 uint
 	jwtAuthToken                            string
 	cfgFile, metaCfgFile, dnsCfgFile        string
@@ -41,7 +44,7 @@ var rootCmd = &cobra.Command{
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
@@ -88,6 +91,15 @@ func init() {
 	rootCmd.PersistentFlags().UintVar(&sshPort, "ssh-port", uint(22),
 		"Port SSH is listening on the remote host")
 
+	rootCmd.PersistentFlags().BoolVar(&askSudoPass, "ask-sudo-pass", false,
+		"Prompt once for the sudo password on hosts without passwordless sudo")
+
+	rootCmd.PersistentFlags().StringVar(&sudoPasswordCmd, "sudo-password-cmd", "",
+		"Local command whose output is the sudo password, e.g. 'pass show infra/sudo'")
+
+	rootCmd.PersistentFlags().StringVar(&inventoryPath, "inventory", "",
+		"Host inventory YAML used by --target (default ~/.config/infractl/inventory.yaml)")
+
 	// Read Viper config before execution
 	cobra.OnInitialize(func() {
 		initConfig()
@@ -110,6 +122,9 @@ func initConfig() {
 	rootViperCfg.BindPFlag("ssh_port", rootCmd.PersistentFlags().Lookup("ssh-port"))
 	rootViperCfg.BindPFlag("ssh_remote_host", rootCmd.PersistentFlags().Lookup("ssh-remote-host"))
 	rootViperCfg.BindPFlag("ssh_remote_user", rootCmd.PersistentFlags().Lookup("ssh-remote-user"))
+	rootViperCfg.BindPFlag("ask_sudo_pass", rootCmd.PersistentFlags().Lookup("ask-sudo-pass"))
+	rootViperCfg.BindPFlag("sudo_password_cmd", rootCmd.PersistentFlags().Lookup("sudo-password-cmd"))
+	rootViperCfg.BindPFlag("inventory", rootCmd.PersistentFlags().Lookup("inventory"))
 	rootViperCfg.BindPFlag("optional_config", rootCmd.PersistentFlags().Lookup("optional-config"))
 	rootViperCfg.BindPFlag("cpu_profile", rootCmd.PersistentFlags().Lookup("cpu-profile"))
 
@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/babbage88/infra-cli/internal/pretty"
+	"github.com/babbage88/infra-cli/ssh"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	authKeysHostnames  map[string]string
+	authKeysConfigFile string
+	authKeysUser       string
+	authKeysFiles      []string
+	authKeysYes        bool
+	authKeysTarget     string
+)
+
+var sshAuthorizedKeysCmd = &cobra.Command{
+	Use:   "authorized-keys",
+	Short: "List, add, remove and sync ~/.ssh/authorized_keys on many hosts",
+	Long: `Manage ~/.ssh/authorized_keys over SFTP on every host from --hostnames, --config-file or --target.
+
+By default the file of the user infractl connects as is managed; --user manages another
+account's file instead (this usually requires connecting as root). Keys are matched by
+fingerprint, and key options and comment lines are preserved when the file is rewritten.`,
+}
+
+var sshAuthorizedKeysListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the keys in authorized_keys on each host",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		targets, err := resolveSshTargets(authKeysHostnames, authKeysConfigFile, authKeysTarget)
+		if err != nil {
+			return err
+		}
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+
+		var mu sync.Mutex
+		listed := make(map[sshTarget][]ssh.AuthorizedKey, len(targets))
+		errs := forEachSshTarget(targets, func(target sshTarget, agent *ssh.RemoteAppDeploymentAgent) error {
+			entries, err := agent.ReadAuthorizedKeys(ctx, authKeysUser)
+			mu.Lock()
+			listed[target] = entries
+			mu.Unlock()
+			return err
+		})
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "HOST\tTYPE\tFINGERPRINT\tCOMMENT\tOPTIONS")
+		for _, target := range targets {
+			for _, e := range listed[target] {
+				if e.Key == nil {
+					continue
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", target, e.Key.Type(), e.Fingerprint, e.Comment, strings.Join(e.Options, ","))
+			}
+		}
+		w.Flush()
+
+		for _, target := range targets {
+			if err := errs[target]; err != nil {
+				pretty.PrintErrorf("[%s] failed: %s", target, err.Error())
+			}
+		}
+		return failedTargetsError(targets, errs)
+	},
+}
+
+var sshAuthorizedKeysAddCmd = &cobra.Command{
+	Use:   "add [public-key-line...]",
+	Short: "Add public keys to authorized_keys on each host",
+	Long: `Add public keys to authorized_keys on each host. Keys are given as full authorized_keys
+lines (options are kept) and/or read from --key-file. Keys already present are skipped.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keys, err := loadAuthorizedKeyArgs(args, authKeysFiles)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return fmt.Errorf("no keys given, pass key lines or --key-file")
+		}
+		targets, err := resolveSshTargets(authKeysHostnames, authKeysConfigFile, authKeysTarget)
+		if err != nil {
+			return err
+		}
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+
+		errs := forEachSshTarget(targets, func(target sshTarget, agent *ssh.RemoteAppDeploymentAgent) error {
+			current, err := agent.ReadAuthorizedKeys(ctx, authKeysUser)
+			if err != nil {
+				return err
+			}
+			added, _ := ssh.DiffAuthorizedKeys(current, keys)
+			if len(added) == 0 {
+				return nil
+			}
+			for _, e := range added {
+				fmt.Printf("[%s] + %s %s\n", target, e.Fingerprint, e.Comment)
+			}
+			return agent.WriteAuthorizedKeys(ctx, authKeysUser, append(current, added...))
+		})
+		return reportSshTargetErrors(targets, errs)
+	},
+}
+
+var sshAuthorizedKeysRemoveCmd = &cobra.Command{
+	Use:          "remove <fingerprint-or-comment>...",
+	Short:        "Remove keys matching a fingerprint or comment from authorized_keys on each host",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		targets, err := resolveSshTargets(authKeysHostnames, authKeysConfigFile, authKeysTarget)
+		if err != nil {
+			return err
+		}
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+
+		errs := forEachSshTarget(targets, func(target sshTarget, agent *ssh.RemoteAppDeploymentAgent) error {
+			current, err := agent.ReadAuthorizedKeys(ctx, authKeysUser)
+			if err != nil {
+				return err
+			}
+			kept, removed := ssh.RemoveAuthorizedKeys(current, args)
+			if len(removed) == 0 {
+				return nil
+			}
+			for _, e := range removed {
+				fmt.Printf("[%s] - %s %s\n", target, e.Fingerprint, e.Comment)
+			}
+			return agent.WriteAuthorizedKeys(ctx, authKeysUser, kept)
+		})
+		return reportSshTargetErrors(targets, errs)
+	},
+}
+
+var sshAuthorizedKeysSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Make authorized_keys on each host match a desired list of keys",
+	Long: `Make authorized_keys on each host contain exactly the desired keys, removing all others.
+
+The desired keys come from --key-file and/or the authorized_keys list in --config-file:
+
+  hostnames:
+    root: [host1, host2]
+  authorized_keys:
+    - ssh-ed25519 AAAA... alice@laptop
+    - from="10.0.0.0/8" ssh-ed25519 AAAA... ci
+
+The changes for every host are shown first and applied only after confirmation (or --yes).`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		desired, err := loadAuthorizedKeyArgs(nil, authKeysFiles)
+		if err != nil {
+			return err
+		}
+		if authKeysConfigFile != "" {
+			v := viper.New()
+			v.SetConfigFile(authKeysConfigFile)
+			if err := v.ReadInConfig(); err != nil {
+				return fmt.Errorf("failed to read config file: %w", err)
+			}
+			fromConfig, err := loadAuthorizedKeyArgs(v.GetStringSlice("authorized_keys"), nil)
+			if err != nil {
+				return err
+			}
+			desired = append(desired, fromConfig...)
+		}
+		if len(desired) == 0 {
+			// An empty list would lock everyone out.
+			return fmt.Errorf("no desired keys found in --key-file or authorized_keys in --config-file")
+		}
+
+		targets, err := resolveSshTargets(authKeysHostnames, authKeysConfigFile, authKeysTarget)
+		if err != nil {
+			return err
+		}
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+
+		var mu sync.Mutex
+		planned := make(map[sshTarget][]ssh.AuthorizedKey)
+		errs := forEachSshTarget(targets, func(target sshTarget, agent *ssh.RemoteAppDeploymentAgent) error {
+			current, err := agent.ReadAuthorizedKeys(ctx, authKeysUser)
+			if err != nil {
+				return err
+			}
+			synced := ssh.SyncAuthorizedKeys(current, desired)
+			if string(ssh.FormatAuthorizedKeys(synced)) == string(ssh.FormatAuthorizedKeys(current)) {
+				return nil
+			}
+
+			added, removed := ssh.DiffAuthorizedKeys(current, synced)
+			mu.Lock()
+			defer mu.Unlock()
+			planned[target] = synced
+			fmt.Printf("[%s]\n", target)
+			for _, e := range removed {
+				fmt.Printf("  - %s\n", e.Raw)
+			}
+			for _, e := range added {
+				fmt.Printf("  + %s\n", e.Raw)
+			}
+			if len(added) == 0 && len(removed) == 0 {
+				fmt.Println("  ~ options or comments changed")
+			}
+			return nil
+		})
+		if err := failedTargetsError(targets, errs); err != nil {
+			return reportSshTargetErrors(targets, errs)
+		}
+		if len(planned) == 0 {
+			pretty.Print("authorized_keys already in sync on all hosts")
+			return nil
+		}
+		if !authKeysYes && !confirm(fmt.Sprintf("Apply changes to %d host(s)?", len(planned))) {
+			return fmt.Errorf("aborted")
+		}
+
+		var changed []sshTarget
+		for target := range planned {
+			changed = append(changed, target)
+		}
+		errs = forEachSshTarget(changed, func(target sshTarget, agent *ssh.RemoteAppDeploymentAgent) error {
+			return agent.WriteAuthorizedKeys(ctx, authKeysUser, planned[target])
+		})
+		return reportSshTargetErrors(changed, errs)
+	},
+}
+
+func init() {
+	sshSubCmd.AddCommand(sshAuthorizedKeysCmd)
+	sshAuthorizedKeysCmd.AddCommand(sshAuthorizedKeysListCmd, sshAuthorizedKeysAddCmd, sshAuthorizedKeysRemoveCmd, sshAuthorizedKeysSyncCmd)
+
+	sshAuthorizedKeysCmd.PersistentFlags().StringToStringVar(&authKeysHostnames, "hostnames", nil, "Map of username to hostnames (e.g. --hostnames root=host1,host2)")
+	sshAuthorizedKeysCmd.PersistentFlags().StringVar(&authKeysConfigFile, "config-file", "", "Path to YAML config file containing hostnames map (and authorized_keys for sync)")
+	sshAuthorizedKeysCmd.PersistentFlags().StringVarP(&authKeysTarget, "target", "t", "", targetFlagUsage)
+	sshAuthorizedKeysCmd.PersistentFlags().StringVar(&authKeysUser, "user", "", "Remote user whose authorized_keys is managed (default the connecting user)")
+	sshAuthorizedKeysAddCmd.Flags().StringSliceVar(&authKeysFiles, "key-file", nil, "Read keys from these public key or authorized_keys files")
+	sshAuthorizedKeysSyncCmd.Flags().StringSliceVar(&authKeysFiles, "key-file", nil, "Read desired keys from these public key or authorized_keys files")
+	sshAuthorizedKeysSyncCmd.Flags().BoolVarP(&authKeysYes, "yes", "y", false, "Apply changes without asking for confirmation")
+}
+
+// loadAuthorizedKeyArgs parses key lines and the keys in files, rejecting anything that is not a key.
+func loadAuthorizedKeyArgs(lines []string, files []string) ([]ssh.AuthorizedKey, error) {
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("error reading key file: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	keys := make([]ssh.AuthorizedKey, 0, len(lines))
+	for _, line := range lines {
+		entry := ssh.ParseAuthorizedKeyLine(strings.TrimSpace(line))
+		if entry.Key == nil {
+			return nil, fmt.Errorf("invalid authorized key %q", line)
+		}
+		keys = append(keys, entry)
+	}
+	return ssh.DedupeAuthorizedKeys(keys), nil
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/babbage88/infra-cli/ssh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	sshCopyHostnames     map[string]string
+	sshCopyConfigFile    string
+	sshCopyPreserveMode  bool
+	sshCopyPreserveOwner bool
+	sshCopyTarget        string
+)
+
+var sshGetCmd = &cobra.Command{
+	Use:   "get <remote-path-or-glob> <local-destination>",
+	Short: "Download files or directories from one or many hosts over SFTP",
+	Long: `Download files or directories from one or many hosts over SFTP.
+
+The remote path may be a glob (e.g. /var/log/app/*.log). The local destination is a
+Go template rendered per host with .Host and .User, e.g. ./out/{{.Host}}/app.log.
+When more than one host is targeted the destination must reference .Host.`,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		remotePattern, dstTemplate := args[0], args[1]
+
+		targets, err := resolveSshTargets(sshCopyHostnames, sshCopyConfigFile, sshCopyTarget)
+		if err != nil {
+			return err
+		}
+
+		tmpl, err := template.New("dst").Option("missingkey=error").Parse(dstTemplate)
+		if err != nil {
+			return fmt.Errorf("invalid destination template: %w", err)
+		}
+		if len(targets) > 1 && !strings.Contains(dstTemplate, ".Host") {
+			return fmt.Errorf("destination must include {{.Host}} when downloading from %d hosts", len(targets))
+		}
+
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+
+		opts := ssh.CopyOptions{PreserveMode: sshCopyPreserveMode, PreserveOwner: sshCopyPreserveOwner}
+		errs := forEachSshTarget(targets, func(target sshTarget, agent *ssh.RemoteAppDeploymentAgent) error {
+			var dst bytes.Buffer
+			if err := tmpl.Execute(&dst, target); err != nil {
+				return fmt.Errorf("error rendering destination: %w", err)
+			}
+			files, err := agent.DownloadGlob(ctx, remotePattern, dst.String(), opts)
+			for _, f := range files {
+				fmt.Printf("[%s] %s -> %s\n", target, remotePattern, f)
+			}
+			return err
+		})
+		return reportSshTargetErrors(targets, errs)
+	},
+}
+
+func init() {
+	sshSubCmd.AddCommand(sshGetCmd)
+
+	addSshCopyFlags(sshGetCmd)
+}
+
+func addSshCopyFlags(cmd *cobra.Command) {
+	cmd.Flags().StringToStringVar(&sshCopyHostnames, "hostnames", nil, "Map of username to hostnames (e.g. --hostnames root=host1,host2 --hostnames jsmith=host3)")
+	cmd.Flags().StringVar(&sshCopyConfigFile, "config-file", "", "Path to YAML config file containing hostnames map")
+	addTargetFlag(cmd, &sshCopyTarget)
+	cmd.Flags().BoolVarP(&sshCopyPreserveMode, "preserve", "p", false, "Preserve file modes and modification times")
+	cmd.Flags().BoolVar(&sshCopyPreserveOwner, "preserve-owner", false, "Preserve file owner and group (requires root on the receiving side)")
+}
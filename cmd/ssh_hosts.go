@@ -0,0 +1,371 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/babbage88/infra-cli/internal/pretty"
+	"github.com/babbage88/infra-cli/inventory"
+	"github.com/babbage88/infra-cli/proxmox"
+	"github.com/babbage88/infra-cli/ssh"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// sshTarget is a single user@host pair that a host-targeting command connects to. Port, Key and
+// JumpHost come from the inventory and fall back to the root ssh_* settings when empty.
+type sshTarget struct {
+	Name     string `json:"name,omitempty" yaml:"name,omitempty"`
+	User     string `json:"user" yaml:"user"`
+	Host     string `json:"host" yaml:"host"`
+	Port     uint   `json:"port,omitempty" yaml:"port,omitempty"`
+	Key      string `json:"key,omitempty" yaml:"key,omitempty"`
+	JumpHost string `json:"jumpHost,omitempty" yaml:"jumpHost,omitempty"`
+}
+
+func (t sshTarget) String() string {
+	return fmt.Sprintf("%s@%s", t.User, t.Host)
+}
+
+const targetFlagUsage = "Inventory hosts to target, e.g. group:web,&tag:prod,!host:db1 or pve-tag:web (see --inventory)"
+
+// addTargetFlag registers --target on a host-targeting command.
+func addTargetFlag(cmd *cobra.Command, target *string) {
+	cmd.Flags().StringVarP(target, "target", "t", "", targetFlagUsage)
+}
+
+// loadInventory loads --inventory (inventory in config), or ~/.config/infractl/inventory.yaml.
+func loadInventory() (*inventory.Inventory, error) {
+	path := rootViperCfg.GetString("inventory")
+	if path == "" {
+		path = filepath.Join(GetConfigPath(), "inventory.yaml")
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no inventory found, pass --inventory or create %s", path)
+		}
+	}
+	return inventory.Load(path)
+}
+
+// defaultSshUser is ssh_remote_user, or the local username.
+func defaultSshUser() string {
+	username := rootViperCfg.GetString("ssh_remote_user")
+	if username == "" {
+		if current, err := user.Current(); err == nil {
+			username = current.Username
+		}
+	}
+	return username
+}
+
+func sshTargetFromHost(h *inventory.Host) sshTarget {
+	target := sshTarget{
+		Name:     h.Name,
+		User:     h.User,
+		Host:     h.Address,
+		Port:     h.Port,
+		Key:      h.Key,
+		JumpHost: h.JumpHost,
+	}
+	if target.User == "" {
+		target.User = defaultSshUser()
+	}
+	return target
+}
+
+// selectSshTargets resolves a --target expression against the inventory, adding the hosts
+// discovered from Proxmox when the expression has pve-* terms.
+func selectSshTargets(expr string) ([]sshTarget, error) {
+	selector, err := inventory.ParseSelector(expr)
+	if err != nil {
+		return nil, err
+	}
+	inv, err := loadInventory()
+	if err != nil {
+		// pve-* targets work from the proxmox_* root config alone, without an inventory file.
+		if !selector.UsesProxmox() || rootViperCfg.GetString("inventory") != "" {
+			return nil, err
+		}
+		inv = &inventory.Inventory{}
+	}
+
+	hosts := inv.Resolve()
+	if selector.UsesProxmox() {
+		auth, err := inventoryProxmoxAuth(inv)
+		if err != nil {
+			return nil, err
+		}
+		client, err := newProxmoxClient(auth)
+		if err != nil {
+			return nil, err
+		}
+		discovered, err := inv.ProxmoxHosts(context.Background(), client)
+		if err != nil {
+			return nil, err
+		}
+		hosts = inventory.MergeHosts(hosts, discovered)
+	}
+
+	var targets []sshTarget
+	for _, h := range selector.Select(hosts) {
+		targets = append(targets, sshTargetFromHost(h))
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("--target %q matched no hosts", expr)
+	}
+	return targets, nil
+}
+
+// inventoryProxmoxAuth returns the Proxmox API credentials for dynamic inventory from the
+// inventory's proxmox section, its config_file, or the proxmox_host_url and proxmox_api_token
+// root config, in that order. TLS settings are looked up the same way.
+func inventoryProxmoxAuth(inv *inventory.Inventory) (proxmox.Auth, error) {
+	source := inv.Proxmox
+	if source == nil {
+		source = &inventory.ProxmoxSource{}
+	}
+	vp := viper.New()
+	if source.ConfigFile != "" {
+		if err := loadProxmoxConfigFile(expandHome(source.ConfigFile), vp); err != nil {
+			return proxmox.Auth{}, err
+		}
+	}
+
+	auth := proxmox.Auth{
+		Host:     cmp.Or(source.HostURL, vp.GetString("host_url"), rootViperCfg.GetString("proxmox_host_url")),
+		ApiToken: cmp.Or(source.ApiToken, vp.GetString("api_token"), rootViperCfg.GetString("proxmox_api_token")),
+		TLS:      proxmoxTLSFromConfig(vp, source.TLS),
+	}
+	if auth.Host == "" || auth.ApiToken == "" {
+		return proxmox.Auth{}, fmt.Errorf("pve-* targets need host_url and api_token in the inventory proxmox section, its config_file, or proxmox_host_url and proxmox_api_token in the config")
+	}
+	return auth, nil
+}
+
+// resolveSshTargets merges the user=host1,host2 flag map, the hostnames map from an optional
+// YAML config file and the inventory hosts matching the --target expression, deduplicating hosts
+// per user when more than one source is supplied.
+func resolveSshTargets(hostnames map[string]string, cfgPath string, targetExpr string) ([]sshTarget, error) {
+	hostMap := make(map[string][]string)
+
+	// Step 1: Load config file into hostMap
+	configLoaded := false
+	if cfgPath != "" {
+		if err := loadHostMapFromConfig(cfgPath, hostMap); err != nil {
+			return nil, err
+		}
+		configLoaded = true
+	}
+
+	// Step 2: Merge flags into hostMap
+	flagProvided := len(hostnames) > 0
+	if flagProvided {
+		mergeHostMapFromFlags(hostnames, hostMap)
+	}
+
+	// Step 3: Deduplicate only if both were provided
+	if configLoaded && flagProvided {
+		dedupeHostMap(hostMap)
+	}
+
+	var targets []sshTarget
+	for user, hosts := range hostMap {
+		for _, host := range hosts {
+			targets = append(targets, sshTarget{User: user, Host: host})
+		}
+	}
+
+	if targetExpr != "" {
+		selected, err := selectSshTargets(targetExpr)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range selected {
+			duplicate := false
+			for _, existing := range targets {
+				duplicate = duplicate || (existing.User == t.User && existing.Host == t.Host)
+			}
+			if !duplicate {
+				targets = append(targets, t)
+			}
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no hosts provided from --hostnames, --config-file or --target")
+	}
+	// Map iteration order is random; sort so batches and output are stable between runs.
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Host != targets[j].Host {
+			return targets[i].Host < targets[j].Host
+		}
+		return targets[i].User < targets[j].User
+	})
+	return targets, nil
+}
+
+// parseSshTargetArg resolves a single [user@]host[:port] argument. A host that names an inventory
+// host uses its address and settings, otherwise the user defaults to ssh_remote_user or the local
+// user.
+func parseSshTargetArg(arg string) (sshTarget, error) {
+	username, host, hasUser := strings.Cut(arg, "@")
+	if !hasUser {
+		username, host = "", arg
+	}
+
+	if inv, err := loadInventory(); err == nil {
+		if h, ok := inv.Host(host); ok {
+			target := sshTargetFromHost(h)
+			if hasUser {
+				target.User = username
+			}
+			return target, nil
+		}
+	} else if rootViperCfg.GetString("inventory") != "" {
+		// An explicitly configured inventory that fails to load is an error, a missing default is not.
+		return sshTarget{}, err
+	}
+
+	target := sshTarget{User: username, Host: host}
+	if !hasUser {
+		target.User = defaultSshUser()
+	}
+	if h, p, err := splitHostPort(host); err == nil {
+		target.Host, target.Port = h, p
+	}
+	return target, nil
+}
+
+// splitHostPort splits host:port, accepting [v6]:port, and fails when there is no port.
+func splitHostPort(s string) (string, uint, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 || strings.Count(s, ":") > 1 && !strings.HasPrefix(s, "[") {
+		return "", 0, fmt.Errorf("no port in %q", s)
+	}
+	port, err := strconv.ParseUint(s[i+1:], 10, 16)
+	if err != nil {
+		return "", 0, err
+	}
+	return strings.Trim(s[:i], "[]"), uint(port), nil
+}
+
+// expandHome expands a leading ~/ to the local home directory.
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// newSshTargetAgent connects to target using its inventory settings, falling back to the root
+// ssh_* settings, and through its jump host when it has one.
+func newSshTargetAgent(target sshTarget) (*ssh.RemoteAppDeploymentAgent, error) {
+	key := rootViperCfg.GetString("ssh_key")
+	if target.Key != "" {
+		key = expandHome(target.Key)
+	}
+	port := rootViperCfg.GetUint("ssh_port")
+	if target.Port != 0 {
+		port = target.Port
+	}
+
+	if target.JumpHost == "" {
+		return ssh.NewRemoteAppDeploymentAgentWithSshKey(
+			target.Host, target.User, "", "",
+			key,
+			rootViperCfg.GetString("ssh_passphrase"),
+			nil,
+			rootViperCfg.GetBool("ssh_use_agent"),
+			port,
+		)
+	}
+
+	jumpTarget, err := parseSshTargetArg(target.JumpHost)
+	if err != nil {
+		return nil, err
+	}
+	if jumpTarget.Host == target.Host {
+		return nil, fmt.Errorf("host %s is its own jump host", target.Host)
+	}
+	jump, err := newSshTargetAgent(jumpTarget)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to jump host %s: %w", jumpTarget, err)
+	}
+	agent, err := ssh.NewRemoteAppDeploymentAgentViaJumpHost(
+		jump,
+		target.Host, target.User,
+		key,
+		rootViperCfg.GetString("ssh_passphrase"),
+		nil,
+		rootViperCfg.GetBool("ssh_use_agent"),
+		port,
+	)
+	if err != nil {
+		jump.Close()
+		return nil, err
+	}
+	return agent, nil
+}
+
+// forEachSshTarget connects to every target concurrently and calls fn with the connected agent.
+// It returns the error, if any, for each target.
+func forEachSshTarget(targets []sshTarget, fn func(target sshTarget, agent *ssh.RemoteAppDeploymentAgent) error) map[sshTarget]error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(map[sshTarget]error, len(targets))
+
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target sshTarget) {
+			defer wg.Done()
+			agent, err := newSshTargetAgent(target)
+			if err == nil {
+				defer agent.Close()
+				err = fn(target, agent)
+			} else {
+				err = fmt.Errorf("connection failed: %w", err)
+			}
+			mu.Lock()
+			errs[target] = err
+			mu.Unlock()
+		}(target)
+	}
+	wg.Wait()
+	return errs
+}
+
+// reportSshTargetErrors prints one line per target and returns an error if any target failed.
+func reportSshTargetErrors(targets []sshTarget, errs map[sshTarget]error) error {
+	for _, target := range targets {
+		if err := errs[target]; err != nil {
+			pretty.PrintErrorf("[%s] failed: %s", target, err.Error())
+		} else {
+			pretty.Printf("[%s] ok", target)
+		}
+	}
+	return failedTargetsError(targets, errs)
+}
+
+// failedTargetsError returns an error counting the failed targets, or nil when none failed.
+func failedTargetsError(targets []sshTarget, errs map[sshTarget]error) error {
+	failed := 0
+	for _, target := range targets {
+		if errs[target] != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d host(s) failed", failed, len(targets))
+	}
+	return nil
+}
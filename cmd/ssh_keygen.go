@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/babbage88/infra-cli/internal/pretty"
+	"github.com/babbage88/infra-cli/ssh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	keygenOut          string
+	keygenComment      string
+	keygenPassphrase   string
+	keygenForce        bool
+	keygenCaKey        string
+	keygenCaPassphrase string
+	keygenPrincipals   []string
+	keygenKeyId        string
+	keygenValidFrom    string
+	keygenValidFor     time.Duration
+	keygenDistribute   map[string]string
+	keygenConfigFile   string
+	keygenTarget       string
+)
+
+var sshKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate an ed25519 keypair, optionally sign it with a CA and install it on hosts",
+	Long: `Generate an ed25519 keypair written to --out and --out.pub.
+
+With --ca-key the public key is signed as an OpenSSH user certificate and written to
+--out-cert.pub; infractl presents the certificate automatically whenever --ssh-key
+points at --out. With --hostnames, --config-file or --target the public key is appended to
+~/.ssh/authorized_keys on each host. The public key line is printed so it can be
+passed to 'proxmox lxc create --ssh-public-keys' or --ssh-public-key-files.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if keygenOut == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return err
+			}
+			keygenOut = filepath.Join(home, ".ssh", "id_ed25519_infractl")
+		}
+		if _, err := os.Stat(keygenOut); err == nil && !keygenForce {
+			return fmt.Errorf("%s already exists, use --force to overwrite", keygenOut)
+		}
+
+		keyPair, err := ssh.GenerateEd25519KeyPair(keygenComment, keygenPassphrase)
+		if err != nil {
+			return fmt.Errorf("error generating key: %w", err)
+		}
+		if err := keyPair.WriteFiles(keygenOut); err != nil {
+			return fmt.Errorf("error writing key files: %w", err)
+		}
+		pretty.Printf("Wrote %s and %s.pub", keygenOut, keygenOut)
+
+		if keygenCaKey != "" {
+			opts := ssh.CertOptions{KeyId: keygenKeyId, Principals: keygenPrincipals}
+			if keygenKeyId == "" {
+				opts.KeyId = keygenComment
+			}
+			if keygenValidFrom != "" {
+				opts.ValidFrom, err = time.Parse(time.RFC3339, keygenValidFrom)
+				if err != nil {
+					return fmt.Errorf("invalid --valid-from, expected RFC3339: %w", err)
+				}
+			}
+			if keygenValidFor > 0 {
+				from := opts.ValidFrom
+				if from.IsZero() {
+					from = time.Now()
+				}
+				opts.ValidTo = from.Add(keygenValidFor)
+			}
+
+			cert, err := ssh.SignUserCertificate(keygenCaKey, keygenCaPassphrase, keyPair.PublicKey, opts)
+			if err != nil {
+				return err
+			}
+			certPath := ssh.CertificatePathForKey(keygenOut)
+			if err := os.WriteFile(certPath, cert, 0o644); err != nil {
+				return fmt.Errorf("error writing certificate: %w", err)
+			}
+			pretty.Printf("Wrote certificate %s principals: %v", certPath, keygenPrincipals)
+		}
+
+		fmt.Println(keyPair.AuthorizedKey)
+
+		if len(keygenDistribute) == 0 && keygenConfigFile == "" && keygenTarget == "" {
+			return nil
+		}
+		targets, err := resolveSshTargets(keygenDistribute, keygenConfigFile, keygenTarget)
+		if err != nil {
+			return err
+		}
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+
+		errs := forEachSshTarget(targets, func(target sshTarget, agent *ssh.RemoteAppDeploymentAgent) error {
+			_, err := agent.AddAuthorizedKey(ctx, "", keyPair.AuthorizedKey)
+			return err
+		})
+		return reportSshTargetErrors(targets, errs)
+	},
+}
+
+func init() {
+	sshSubCmd.AddCommand(sshKeygenCmd)
+
+	sshKeygenCmd.Flags().StringVarP(&keygenOut, "out", "o", "", "Private key output path (default ~/.ssh/id_ed25519_infractl)")
+	sshKeygenCmd.Flags().StringVarP(&keygenComment, "comment", "C", "", "Key comment, e.g. user@workstation")
+	sshKeygenCmd.Flags().StringVar(&keygenPassphrase, "passphrase", "", "Passphrase to encrypt the private key")
+	sshKeygenCmd.Flags().BoolVar(&keygenForce, "force", false, "Overwrite an existing key at --out")
+	sshKeygenCmd.Flags().StringVar(&keygenCaKey, "ca-key", "", "CA private key used to sign a user certificate")
+	sshKeygenCmd.Flags().StringVar(&keygenCaPassphrase, "ca-passphrase", "", "Passphrase for --ca-key")
+	sshKeygenCmd.Flags().StringSliceVar(&keygenPrincipals, "principals", nil, "Certificate principals (remote usernames)")
+	sshKeygenCmd.Flags().StringVar(&keygenKeyId, "key-id", "", "Certificate key id (defaults to --comment)")
+	sshKeygenCmd.Flags().StringVar(&keygenValidFrom, "valid-from", "", "Certificate start time in RFC3339 (default now)")
+	sshKeygenCmd.Flags().DurationVar(&keygenValidFor, "valid-for", 0, "Certificate lifetime, e.g. 24h (0 never expires)")
+	sshKeygenCmd.Flags().StringToStringVar(&keygenDistribute, "hostnames", nil, "Install the public key on these hosts (e.g. --hostnames root=host1,host2)")
+	sshKeygenCmd.Flags().StringVar(&keygenConfigFile, "config-file", "", "Path to YAML config file containing hostnames map to install the public key on")
+	addTargetFlag(sshKeygenCmd, &keygenTarget)
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/babbage88/infra-cli/ssh"
+	"github.com/spf13/cobra"
+)
+
+var sshPutCmd = &cobra.Command{
+	Use:   "put <local-path> <remote-destination>",
+	Short: "Upload a file or directory to one or many hosts over SFTP",
+	Long: `Upload a file or directory to one or many hosts over SFTP.
+
+Directories are copied recursively. A remote destination ending in "/" or naming an
+existing directory receives the source under its own base name.`,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		src, dst := args[0], args[1]
+		if _, err := os.Stat(src); err != nil {
+			return fmt.Errorf("could not stat %s: %w", src, err)
+		}
+
+		targets, err := resolveSshTargets(sshCopyHostnames, sshCopyConfigFile, sshCopyTarget)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+
+		opts := ssh.CopyOptions{PreserveMode: sshCopyPreserveMode, PreserveOwner: sshCopyPreserveOwner}
+		errs := forEachSshTarget(targets, func(target sshTarget, agent *ssh.RemoteAppDeploymentAgent) error {
+			files, err := agent.UploadTree(ctx, src, dst, opts)
+			for _, f := range files {
+				fmt.Printf("[%s] %s -> %s\n", target, src, f)
+			}
+			return err
+		})
+		return reportSshTargetErrors(targets, errs)
+	},
+}
+
+func init() {
+	sshSubCmd.AddCommand(sshPutCmd)
+
+	addSshCopyFlags(sshPutCmd)
+}
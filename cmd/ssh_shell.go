@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/spf13/cobra"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var sshShellCmd = &cobra.Command{
+	Use:   "shell [user@]host [-- command...]",
+	Short: "Open an interactive shell on a remote host using infractl's ssh settings",
+	Long: `Open an interactive shell with a PTY on a remote host, using the same key, agent and
+host key verification as every other infractl command. Anything after -- is run
+inside the PTY instead of the login shell, e.g. infractl ssh shell db1 -- htop`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		target, err := parseSshTargetArg(args[0])
+		if err != nil {
+			return err
+		}
+
+		agent, err := newSshTargetAgent(target)
+		if err != nil {
+			return err
+		}
+		defer agent.Close()
+
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+
+		err = agent.Shell(ctx, args[1:])
+		var exitErr *gossh.ExitError
+		if errors.As(err, &exitErr) {
+			// Mirror the remote exit status like ssh(1) does.
+			agent.Close()
+			os.Exit(exitErr.ExitStatus())
+		}
+		return err
+	},
+}
+
+func init() {
+	sshSubCmd.AddCommand(sshShellCmd)
+}
@@ -0,0 +1,12 @@
+package cmd
+
+import "github.com/spf13/cobra"
+
+var sshSubCmd = &cobra.Command{
+	Use:   "ssh",
+	Short: "Commands for copying files to and from remote hosts and other ssh utilities",
+}
+
+func init() {
+	rootCmd.AddCommand(sshSubCmd)
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/babbage88/infra-cli/ssh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tunnelLocalForwards   []string
+	tunnelRemoteForwards  []string
+	tunnelDynamicForwards []string
+)
+
+var sshTunnelCmd = &cobra.Command{
+	Use:   "tunnel [user@]host",
+	Short: "Open local, remote or SOCKS5 port forwards over SSH until interrupted",
+	Long: `Open port forwards over SSH using the configured key, agent and host key policy.
+
+Forwards use OpenSSH syntax:
+  -L [bind_address:]port:host:hostport   listen locally, connect from the remote host
+  -R [bind_address:]port:host:hostport   listen on the remote host, connect from here
+  -D [bind_address:]port                 SOCKS5 proxy that connects from the remote host
+
+The tunnel reconnects automatically if the connection drops. For example, to reach
+PostgreSQL bound to localhost on a container:
+
+  infractl ssh tunnel root@db1 -L 5433:localhost:5432
+  infractl database new-appdb --postgres-hostname localhost --postgres-port 5433`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		target, err := parseSshTargetArg(args[0])
+		if err != nil {
+			return err
+		}
+
+		var forwards []ssh.Forward
+		for kind, specs := range map[ssh.ForwardKind][]string{
+			ssh.LocalForward:   tunnelLocalForwards,
+			ssh.RemoteForward:  tunnelRemoteForwards,
+			ssh.DynamicForward: tunnelDynamicForwards,
+		} {
+			for _, spec := range specs {
+				fwd, err := ssh.ParseForward(kind, spec)
+				if err != nil {
+					return err
+				}
+				forwards = append(forwards, fwd)
+			}
+		}
+		if len(forwards) == 0 {
+			return fmt.Errorf("at least one of -L, -R or -D is required")
+		}
+
+		ctx, stop := interruptContext(cmd)
+		defer stop()
+
+		tunnel := &ssh.Tunnel{
+			Connect: func() (*ssh.RemoteAppDeploymentAgent, error) {
+				return newSshTargetAgent(target)
+			},
+			Forwards: forwards,
+		}
+		fmt.Printf("Opening tunnel to %s, press Ctrl-C to stop\n", target)
+		return tunnel.Run(ctx)
+	},
+}
+
+func init() {
+	sshSubCmd.AddCommand(sshTunnelCmd)
+
+	sshTunnelCmd.Flags().StringArrayVarP(&tunnelLocalForwards, "local", "L", nil, "Local forward [bind_address:]port:host:hostport")
+	sshTunnelCmd.Flags().StringArrayVarP(&tunnelRemoteForwards, "remote", "R", nil, "Remote forward [bind_address:]port:host:hostport")
+	sshTunnelCmd.Flags().StringArrayVarP(&tunnelDynamicForwards, "dynamic", "D", nil, "SOCKS5 proxy [bind_address:]port")
+}
@@ -1,10 +1,57 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
+
+	"github.com/babbage88/infra-cli/ssh"
+	"github.com/spf13/cobra"
 )
 
+// interruptContext returns the command's context cancelled on Ctrl-C or SIGTERM, so in-flight
+// remote commands are killed instead of left running.
+func interruptContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+}
+
+// sudoPasswordSource builds the sudo password lookup from config. The sudo_password key (or the
+// SUDO_PASSWORD env var) wins, then sudo_password_cmd, then an interactive prompt when
+// --ask-sudo-pass is set.
+func sudoPasswordSource() ssh.SudoPasswordFunc {
+	var sources []ssh.SudoPasswordFunc
+	if password := rootViperCfg.GetString("sudo_password"); password != "" {
+		sources = append(sources, ssh.StaticSudoPassword(password))
+	}
+	if passwordCmd := rootViperCfg.GetString("sudo_password_cmd"); passwordCmd != "" {
+		sources = append(sources, ssh.CommandSudoPassword(passwordCmd))
+	}
+	if rootViperCfg.GetBool("ask_sudo_pass") {
+		sources = append(sources, ssh.PromptSudoPassword())
+	}
+	return ssh.FirstSudoPassword(sources...)
+}
+
+// confirm asks a yes/no question on stderr and reads the answer from stdin; anything but y/yes is no.
+func confirm(prompt string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
 func fileNameWithoutExtension(path string) string {
 	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
 } /*
@@ -1,6 +1,7 @@
 package deployer
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
@@ -9,7 +10,7 @@ import (
 	"time"
 )
 
-func (r *RemoteSystemdBinDeployer) TarCopyMove(sourceDir, destinationDir string, excludes []string, sudo bool) error {
+func (r *RemoteSystemdBinDeployer) TarCopyMove(ctx context.Context, sourceDir, destinationDir string, excludes []string, sudo bool) error {
 	// Generate a timestamped tmp dir
 	timestamp := time.Now().Format("20060102_150405")
 	tmpDir := path.Join("/tmp", timestamp)
@@ -27,7 +28,7 @@ func (r *RemoteSystemdBinDeployer) TarCopyMove(sourceDir, destinationDir string,
 
 	// Step 2: Create the /tmp/yyyymmdd_hhmmss remote directory
 	slog.Info("Creating remote tmp directory", slog.String("tmpDir", tmpDir))
-	err = r.SshClient.RunCommand(mkdirCmdBase, []string{"-p", tmpDir})
+	err = r.SshClient.RunCommandContext(ctx, mkdirCmdBase, []string{"-p", tmpDir})
 	if err != nil {
 		return fmt.Errorf("failed to create remote tmp directory: %w", err)
 	}
@@ -43,21 +44,21 @@ func (r *RemoteSystemdBinDeployer) TarCopyMove(sourceDir, destinationDir string,
 	// Step 4: Ensure destination directory exists
 	destMkdirCmd := []string{"-p", destinationDir}
 	if sudo {
-		err = r.SshClient.RunCommand(sudoCmd, destMkdirCmd)
+		err = r.SshClient.RunSudoCommandContext(ctx, mkdirCmdBase, destMkdirCmd)
 	} else {
-		err = r.SshClient.RunCommand(mkdirCmdBase, destMkdirCmd)
+		err = r.SshClient.RunCommandContext(ctx, mkdirCmdBase, destMkdirCmd)
 	}
 	if err != nil {
 		return fmt.Errorf("failed to ensure destination directory: %w", err)
 	}
 
 	// Step 5: Extract archive at destination
-	extractCmd := []string{"tar", "-xzf", tmpRemoteTarPath, "-C", destinationDir}
+	extractCmd := []string{"-xzf", tmpRemoteTarPath, "-C", destinationDir}
 	slog.Info("Extracting archive at destination", slog.String("destinationDir", destinationDir))
 	if sudo {
-		err = r.SshClient.RunCommand(sudoCmd, extractCmd)
+		err = r.SshClient.RunSudoCommandContext(ctx, "tar", extractCmd)
 	} else {
-		err = r.SshClient.RunCommand("", extractCmd)
+		err = r.SshClient.RunCommandContext(ctx, "tar", extractCmd)
 	}
 	if err != nil {
 		return fmt.Errorf("failed to extract archive at destination: %w", err)
@@ -65,7 +66,7 @@ func (r *RemoteSystemdBinDeployer) TarCopyMove(sourceDir, destinationDir string,
 
 	// Step 6: Fix ownership if sudo was used
 	if sudo {
-		chownCmdArgs := make([]string, 3)
+		chownCmdArgs := make([]string, 0, 3)
 		for uid, username := range r.ServiceAccount {
 			args := []string{"-R", fmt.Sprintf("%d:%s", uid, username), destinationDir}
 			chownCmdArgs = append(chownCmdArgs, args...)
@@ -73,7 +74,7 @@ func (r *RemoteSystemdBinDeployer) TarCopyMove(sourceDir, destinationDir string,
 			break
 		}
 
-		err = r.SshClient.RunCommand(sudoCmd, chownCmdArgs)
+		err = r.SshClient.RunSudoCommandContext(ctx, chownCmdBase, chownCmdArgs)
 		if err != nil {
 			return fmt.Errorf("failed to chown extracted files: %w", err)
 		}
@@ -82,7 +83,7 @@ func (r *RemoteSystemdBinDeployer) TarCopyMove(sourceDir, destinationDir string,
 	// Step 7: Clean up remote tmp dir
 	cleanupCmd := []string{"-rf", tmpDir}
 	slog.Info("Cleaning up remote tmp directory", slog.String("tmpDir", tmpDir))
-	err = r.SshClient.RunCommand(sudoCmd, cleanupCmd)
+	err = r.SshClient.RunSudoCommandContext(ctx, "rm", cleanupCmd)
 	if err != nil {
 		return fmt.Errorf("failed to clean up remote tmp directory: %w", err)
 	}
@@ -1,6 +1,7 @@
 package deployer
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/babbage88/infra-cli/internal/archiver"
 	"github.com/babbage88/infra-cli/ssh"
+	"golang.org/x/term"
 )
 
 const (
@@ -30,11 +32,10 @@ const (
 	validateUidCmdFlag      string = "-uid"
 
 	mkdirArgs string = "-p"
-	sudoCmd   string = "sudo"
 )
 
 type AppDeployer interface {
-	InstallApplication() error
+	InstallApplication(ctx context.Context) error
 	ConfigureService(hostName string, serviceAccount map[int64]string, envVars map[string]string)
 }
 
@@ -53,6 +54,8 @@ type RemoteSystemdBinDeployer struct {
 	SourceDir      string                        `json:"sourceDir"`
 	SourceBin      string                        `json:"sourceBin"`
 	DestinationBin string                        `json:"destinationBin"`
+	CommandTimeout time.Duration                 `json:"commandTimeout"`
+	SudoPassword   ssh.SudoPasswordFunc          `json:"-"`
 }
 
 func NewRemoteSystemdDeployer(hostname, sshUser, appName, sourceDir string, opts ...RemoteSystemdDeployerOptions) *RemoteSystemdBinDeployer {
@@ -119,6 +122,20 @@ func WithSourceBin(s string) RemoteSystemdDeployerOptions {
 	}
 }
 
+// WithCommandTimeout bounds each remote command run during the deployment.
+func WithCommandTimeout(d time.Duration) RemoteSystemdDeployerOptions {
+	return func(r *RemoteSystemdBinDeployer) {
+		r.CommandTimeout = d
+	}
+}
+
+// WithSudoPassword sets the password source used on hosts without passwordless sudo.
+func WithSudoPassword(fn ssh.SudoPasswordFunc) RemoteSystemdDeployerOptions {
+	return func(r *RemoteSystemdBinDeployer) {
+		r.SudoPassword = fn
+	}
+}
+
 func (r *RemoteSystemdBinDeployer) StartSshDeploymentAgent(sshKey, sshPassphrase string, EnvVars map[string]string, useSshAgent bool, sshPort uint) error {
 	client, err := ssh.InitializeRemoteSshAgent(
 		r.RemoteHostName,
@@ -134,11 +151,20 @@ func (r *RemoteSystemdBinDeployer) StartSshDeploymentAgent(sshKey, sshPassphrase
 		return fmt.Errorf("error initialize ssh client prior to RemoteSystemdDeployer %w", err)
 	}
 
-	r.SshClient = client
+	r.UseSshDeploymentAgent(client)
 	return nil
 }
 
-func (r *RemoteSystemdBinDeployer) InstallApplication() error {
+// UseSshDeploymentAgent deploys over an already connected agent, e.g. one reached through a jump
+// host, instead of connecting in StartSshDeploymentAgent.
+func (r *RemoteSystemdBinDeployer) UseSshDeploymentAgent(client *ssh.RemoteAppDeploymentAgent) {
+	client.CommandTimeout = r.CommandTimeout
+	client.SudoPassword = r.SudoPassword
+	client.ShowProgress = term.IsTerminal(int(os.Stderr.Fd()))
+	r.SshClient = client
+}
+
+func (r *RemoteSystemdBinDeployer) InstallApplication(ctx context.Context) error {
 	slog.Info("Starting remote deployment")
 	fmt.Println("SourceBin Path", r.SourceBin)
 
@@ -182,19 +208,19 @@ func (r *RemoteSystemdBinDeployer) InstallApplication() error {
 
 	// Create remote install dir
 	sudo := true
-	err = r.MakeInstallDir(sudo)
+	err = r.MakeInstallDir(ctx, sudo)
 	if err != nil {
 		return fmt.Errorf("error creating remote path %w", err)
 	}
 
 	// Create /tmp/{timestamp}/utils on remote
-	err = r.SshClient.RunCommand(mkdirCmdBase, mkdirArgsWithPath(remoteUtilsPath))
+	err = r.SshClient.RunCommandContext(ctx, mkdirCmdBase, mkdirArgsWithPath(remoteUtilsPath))
 	if err != nil {
 		return fmt.Errorf("error creating remote utils path %w", err)
 	}
 
 	// Upload application binary
-	err = r.UploadAndMove(sourceBinPath, r.InstallDir, true)
+	err = r.UploadAndMove(ctx, sourceBinPath, r.InstallDir, true)
 	if err != nil {
 		return fmt.Errorf("error uploading source bin %w", err)
 	}
@@ -207,38 +233,37 @@ func (r *RemoteSystemdBinDeployer) InstallApplication() error {
 
 	// Validate service user
 	for uid, username := range r.ServiceAccount {
-		err := r.chmodFileExecutable(filepath.Join(remoteUtilsPath, remoteValidateUserBaseCmd))
+		err := r.chmodFileExecutable(ctx, filepath.Join(remoteUtilsPath, remoteValidateUserBaseCmd))
 		if err != nil {
 			slog.Error("error encounter making validate-user executable", "error", err.Error())
 			return fmt.Errorf("error making validate-user util executable %w", err)
 		}
-		remoteValidateUserCmdArgs := []string{filepath.Join(remoteUtilsPath, remoteValidateUserBaseCmd),
-			validateUidCmdFlag,
+		remoteValidateUserCmdArgs := []string{validateUidCmdFlag,
 			fmt.Sprintf("%d", uid),
 			validateUsernameCmdFlag,
 			username,
 		}
-		output, err := r.SshClient.RunCommandAndCaptureOutput(sudoCmd, remoteValidateUserCmdArgs)
+		result, err := r.SshClient.RunSudoCommandWithResult(ctx, filepath.Join(remoteUtilsPath, remoteValidateUserBaseCmd), remoteValidateUserCmdArgs)
 		if err != nil {
 			return fmt.Errorf("error validating remote service user/uid: %w", err)
 		}
-		fmt.Println("validate command", string(output))
+		fmt.Println("validate command", result.Stdout)
 	}
 
 	// Create service user if needed
 	userUtilsPath := filepath.Join(remoteUtilsPath, remoteUserUtils)
-	r.CreateUserOnRemote(userUtilsPath)
+	r.CreateUserOnRemote(ctx, userUtilsPath)
 
 	return nil
 }
 
-func (r *RemoteSystemdBinDeployer) CreateUserOnRemote(userUtilsPath string) error {
+func (r *RemoteSystemdBinDeployer) CreateUserOnRemote(ctx context.Context, userUtilsPath string) error {
 	if r.ServiceAccount == nil {
 		return fmt.Errorf("No remote ServiceAccount has bee configured for RemoteSystemdDeployer")
 	}
 	for uid, username := range r.ServiceAccount {
 		Uid := fmt.Sprintf("%d", uid)
-		err := r.SshClient.RunCommand(sudoCmd, []string{userUtilsPath, remoteUserUtilsUsernameFlag, username, remoteUserUtilsUidFlag, Uid})
+		err := r.SshClient.RunSudoCommandContext(ctx, userUtilsPath, []string{remoteUserUtilsUsernameFlag, username, remoteUserUtilsUidFlag, Uid})
 		if err != nil {
 			slog.Error("Failed to create user:", slog.String("ServiceUser", username), slog.Int64("uid", uid), slog.String("error", err.Error()))
 			return fmt.Errorf("failed to create user: %w", err)
@@ -248,20 +273,20 @@ func (r *RemoteSystemdBinDeployer) CreateUserOnRemote(userUtilsPath string) erro
 	return nil
 }
 
-func (r *RemoteSystemdBinDeployer) MakeInstallDir(sudo bool) error {
+func (r *RemoteSystemdBinDeployer) MakeInstallDir(ctx context.Context, sudo bool) error {
 	argsDirs := []string{r.InstallDir, "/temp/utils"}
 	for _, path := range argsDirs {
 		if sudo {
-			output, err := r.SshClient.RunCommandAndCaptureOutput("sudo", []string{"mkdir", "-p", path})
+			result, err := r.SshClient.RunSudoCommandWithResult(ctx, mkdirCmdBase, []string{"-p", path})
 			if err != nil {
 				slog.Error("Error created Install Dir", "error", err.Error())
 				return err
 			}
-			fmt.Println(string(output))
+			fmt.Println(result.Stdout)
 			return err
 
 		} else {
-			output, err := r.SshClient.RunCommandAndCaptureOutput("mkdir", []string{"-p", path})
+			output, err := r.SshClient.RunCommandAndCaptureOutputContext(ctx, "mkdir", []string{"-p", path})
 			if err != nil {
 				slog.Error("Error created Install Dir", "error", err.Error())
 				return err
@@ -282,7 +307,7 @@ func mkdirArgsWithPath(path string) []string {
 
 // UploadAndMove uploads a file to a temporary directory under /tmp and moves it to the final destination using sudo.
 // It ensures idempotency by creating a unique timestamped subdirectory for each upload, and cleans up the temp directory afterward.
-func (r *RemoteSystemdBinDeployer) UploadAndMove(sourcePath, destinationPath string, modExecutable bool) error {
+func (r *RemoteSystemdBinDeployer) UploadAndMove(ctx context.Context, sourcePath, destinationPath string, modExecutable bool) error {
 
 	stat, err := os.Stat(sourcePath)
 	if err != nil {
@@ -292,7 +317,7 @@ func (r *RemoteSystemdBinDeployer) UploadAndMove(sourcePath, destinationPath str
 	// If source is a directory, use MoveAndCopyDirectory
 	if stat.IsDir() {
 		slog.Info("Detected source as directory", slog.String("sourceDir", sourcePath))
-		return r.MoveAndCopyDirectory(sourcePath, destinationPath)
+		return r.MoveAndCopyDirectory(ctx, sourcePath, destinationPath)
 	}
 
 	// If source is a file, continue with existing upload logic
@@ -302,7 +327,7 @@ func (r *RemoteSystemdBinDeployer) UploadAndMove(sourcePath, destinationPath str
 
 	// Create the temp directory on the remote server
 	mkdirArgs := []string{"-p", tmpDir}
-	err = r.SshClient.RunCommand(mkdirCmdBase, mkdirArgs)
+	err = r.SshClient.RunCommandContext(ctx, mkdirCmdBase, mkdirArgs)
 	if err != nil {
 		return fmt.Errorf("failed to create remote temp directory: %w", err)
 	}
@@ -318,27 +343,27 @@ func (r *RemoteSystemdBinDeployer) UploadAndMove(sourcePath, destinationPath str
 	}
 
 	// Move the file into the final destination using sudo
-	moveCmdArgs := []string{"mv", tmpFilePath, destinationPath}
+	moveCmdArgs := []string{tmpFilePath, destinationPath}
 	slog.Info("moving from tmp to destination", slog.String("tmpFilePath", tmpFilePath), slog.String("dst", destinationPath))
-	err = r.SshClient.RunCommand(sudoCmd, moveCmdArgs)
+	err = r.SshClient.RunSudoCommandContext(ctx, "mv", moveCmdArgs)
 	if err != nil {
 		return fmt.Errorf("failed to move file to destination with sudo: %w", err)
 	}
 
 	if modExecutable {
 		// Optional: Set executable bit if needed
-		chmodCmdArgs := []string{"chmod", "+x", destinationPath}
+		chmodCmdArgs := []string{chmodFileExecutableArg, destinationPath}
 		slog.Info("setting destination executable", slog.String("dst", destinationPath))
-		err = r.SshClient.RunCommand(sudoCmd, chmodCmdArgs)
+		err = r.SshClient.RunSudoCommandContext(ctx, chmodCmdBase, chmodCmdArgs)
 		if err != nil {
 			return fmt.Errorf("failed to chmod destination file: %w", err)
 		}
 	}
 
 	// Clean up the temporary upload directory
-	cleanupCmdArgs := []string{"rm", "-rf", tmpDir}
+	cleanupCmdArgs := []string{"-rf", tmpDir}
 	slog.Info("cleaning up the tmp direcotry", slog.String("tmpDir", tmpDir))
-	err = r.SshClient.RunCommand(sudoCmd, cleanupCmdArgs)
+	err = r.SshClient.RunSudoCommandContext(ctx, "rm", cleanupCmdArgs)
 	if err != nil {
 		return fmt.Errorf("failed to clean up temporary directory: %w", err)
 	}
@@ -348,14 +373,14 @@ func (r *RemoteSystemdBinDeployer) UploadAndMove(sourcePath, destinationPath str
 
 // MoveAndCopyDirectory uploads a local directory to a remote temporary path and copies its contents to the destination.
 // It ensures idempotency by creating a unique timestamped directory under /tmp.
-func (r *RemoteSystemdBinDeployer) MoveAndCopyDirectory(sourceDir, destinationDir string) error {
+func (r *RemoteSystemdBinDeployer) MoveAndCopyDirectory(ctx context.Context, sourceDir, destinationDir string) error {
 	// Generate a timestamped temp directory: /tmp/YYYYMMDD_HHmmss
 	timestamp := time.Now().Format("20060102_150405")
 	tmpDir := path.Join("/tmp", timestamp)
 
 	// Create the temp directory on the remote server
 	mkdirArgs := []string{"-p", tmpDir}
-	err := r.SshClient.RunCommand(mkdirCmdBase, mkdirArgs)
+	err := r.SshClient.RunCommandContext(ctx, mkdirCmdBase, mkdirArgs)
 	if err != nil {
 		return fmt.Errorf("failed to create remote temp directory: %w", err)
 	}
@@ -372,23 +397,23 @@ func (r *RemoteSystemdBinDeployer) MoveAndCopyDirectory(sourceDir, destinationDi
 	// Ensure destination directory exists
 	mkdirDestArgs := []string{"-p", destinationDir}
 	slog.Info("Ensuring destination directory exists", slog.String("destinationDir", destinationDir))
-	err = r.SshClient.RunCommand(sudoCmd, mkdirDestArgs)
+	err = r.SshClient.RunSudoCommandContext(ctx, mkdirCmdBase, mkdirDestArgs)
 	if err != nil {
 		return fmt.Errorf("failed to create destination directory: %w", err)
 	}
 
 	// Copy the uploaded directory into the final destination
-	copyCmdArgs := []string{"cp", "-r", tmpUploadPath + "/.", destinationDir}
+	copyCmdArgs := []string{"-r", tmpUploadPath + "/.", destinationDir}
 	slog.Info("Copying from tmp to destination", slog.String("tmpUploadPath", tmpUploadPath), slog.String("destinationDir", destinationDir))
-	err = r.SshClient.RunCommand(sudoCmd, copyCmdArgs)
+	err = r.SshClient.RunSudoCommandContext(ctx, "cp", copyCmdArgs)
 	if err != nil {
 		return fmt.Errorf("failed to copy directory to destination: %w", err)
 	}
 
 	// Clean up the temporary upload directory
-	cleanupCmdArgs := []string{"rm", "-rf", tmpDir}
+	cleanupCmdArgs := []string{"-rf", tmpDir}
 	slog.Info("Cleaning up the tmp directory", slog.String("tmpDir", tmpDir))
-	err = r.SshClient.RunCommand(sudoCmd, cleanupCmdArgs)
+	err = r.SshClient.RunSudoCommandContext(ctx, "rm", cleanupCmdArgs)
 	if err != nil {
 		return fmt.Errorf("failed to clean up temporary directory: %w", err)
 	}
@@ -396,9 +421,9 @@ func (r *RemoteSystemdBinDeployer) MoveAndCopyDirectory(sourceDir, destinationDi
 	return nil
 }
 
-func (r *RemoteSystemdBinDeployer) chmodFileExecutable(path string) error {
-	chmodCmdArgs := []string{chmodCmdBase, chmodFileExecutableArg, path}
-	err := r.SshClient.RunCommand(sudoCmd, chmodCmdArgs)
+func (r *RemoteSystemdBinDeployer) chmodFileExecutable(ctx context.Context, path string) error {
+	chmodCmdArgs := []string{chmodFileExecutableArg, path}
+	err := r.SshClient.RunSudoCommandContext(ctx, chmodCmdBase, chmodCmdArgs)
 	if err != nil {
 		return fmt.Errorf("failed to chmod destination file: %w", err)
 	}
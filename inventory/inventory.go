@@ -0,0 +1,222 @@
+// Package inventory loads named hosts, groups and tags from a YAML file and selects hosts with
+// target expressions such as group:web,&tag:prod,!host:db1.
+package inventory
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/goccy/go-yaml"
+)
+
+// HostVars are the connection settings and labels that can be set on the inventory defaults, on
+// a group or on a single host. Later levels override earlier ones.
+type HostVars struct {
+	User     string            `json:"user,omitempty" yaml:"user,omitempty"`
+	Port     uint              `json:"port,omitempty" yaml:"port,omitempty"`
+	Key      string            `json:"key,omitempty" yaml:"key,omitempty"`
+	JumpHost string            `json:"jumpHost,omitempty" yaml:"jump_host,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// merge overrides v with every field set in o. Labels are merged key by key.
+func (v HostVars) merge(o HostVars) HostVars {
+	if o.User != "" {
+		v.User = o.User
+	}
+	if o.Port != 0 {
+		v.Port = o.Port
+	}
+	if o.Key != "" {
+		v.Key = o.Key
+	}
+	if o.JumpHost != "" {
+		v.JumpHost = o.JumpHost
+	}
+	if len(o.Labels) > 0 {
+		labels := maps.Clone(v.Labels)
+		if labels == nil {
+			labels = make(map[string]string, len(o.Labels))
+		}
+		maps.Copy(labels, o.Labels)
+		v.Labels = labels
+	}
+	return v
+}
+
+// Host is a single machine in the inventory. Address defaults to the host's name.
+type Host struct {
+	Name    string   `json:"name" yaml:"-"`
+	Address string   `json:"address,omitempty" yaml:"address,omitempty"`
+	Tags    []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Groups  []string `json:"groups,omitempty" yaml:"groups,omitempty"`
+	// PveTags are the Proxmox tags of a host discovered from the Proxmox API.
+	PveTags  []string `json:"pveTags,omitempty" yaml:"-"`
+	HostVars `yaml:",inline"`
+}
+
+// Group names a set of hosts, directly and through child groups, and the vars they share.
+type Group struct {
+	Hosts    []string `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	Children []string `json:"children,omitempty" yaml:"children,omitempty"`
+	Vars     HostVars `json:"vars,omitempty" yaml:"vars,omitempty"`
+}
+
+// Inventory is the parsed inventory file:
+//
+//	defaults:
+//	  user: root
+//	hosts:
+//	  web1: {address: 10.0.0.11, tags: [prod], labels: {role: web}}
+//	  db1: {address: 10.0.0.21, user: postgres, jump_host: bastion}
+//	  bastion: {address: bastion.example.com, port: 2222}
+//	groups:
+//	  web: {hosts: [web1], vars: {user: deploy}}
+//	  prod: {children: [web], hosts: [db1]}
+//	proxmox:
+//	  config_file: ~/.config/infractl/proxmox.yaml
+type Inventory struct {
+	Defaults HostVars          `json:"defaults" yaml:"defaults"`
+	Hosts    map[string]*Host  `json:"hosts" yaml:"hosts"`
+	Groups   map[string]*Group `json:"groups" yaml:"groups"`
+	Proxmox  *ProxmoxSource    `json:"proxmox,omitempty" yaml:"proxmox,omitempty"`
+}
+
+// Load reads and validates the inventory file at path.
+func Load(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading inventory: %w", err)
+	}
+	inv := &Inventory{}
+	if err := yaml.Unmarshal(data, inv); err != nil {
+		return nil, fmt.Errorf("error parsing inventory %s: %w", path, err)
+	}
+	if err := inv.validate(); err != nil {
+		return nil, fmt.Errorf("invalid inventory %s: %w", path, err)
+	}
+	return inv, nil
+}
+
+func (inv *Inventory) validate() error {
+	for name, group := range inv.Groups {
+		if group == nil {
+			inv.Groups[name] = &Group{}
+			continue
+		}
+		for _, h := range group.Hosts {
+			if _, ok := inv.Hosts[h]; !ok {
+				return fmt.Errorf("group %s references unknown host %s", name, h)
+			}
+		}
+		for _, c := range group.Children {
+			if _, ok := inv.Groups[c]; !ok {
+				return fmt.Errorf("group %s references unknown group %s", name, c)
+			}
+		}
+	}
+	for name, host := range inv.Hosts {
+		if host == nil {
+			inv.Hosts[name] = &Host{}
+		}
+		for _, g := range inv.Hosts[name].Groups {
+			if _, ok := inv.Groups[g]; !ok {
+				return fmt.Errorf("host %s references unknown group %s", name, g)
+			}
+		}
+	}
+	for name := range inv.Groups {
+		if err := inv.checkCycle(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (inv *Inventory) checkCycle(name string, path []string) error {
+	if slices.Contains(path, name) {
+		return fmt.Errorf("group cycle %v", append(path, name))
+	}
+	for _, c := range inv.Groups[name].Children {
+		if err := inv.checkCycle(c, append(path, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupsOf returns every group host belongs to, directly or through child groups, sorted.
+func (inv *Inventory) groupsOf(host string) []string {
+	var groups []string
+	var member func(group string) bool
+	member = func(group string) bool {
+		g := inv.Groups[group]
+		if slices.Contains(g.Hosts, host) || slices.Contains(inv.Hosts[host].Groups, group) {
+			return true
+		}
+		return slices.ContainsFunc(g.Children, member)
+	}
+	for name := range inv.Groups {
+		if member(name) {
+			groups = append(groups, name)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// Resolve returns every host sorted by name with Address defaulted, Groups expanded to all the
+// groups the host is in, and vars merged from the defaults, its groups (outermost first, ties by
+// name) and the host itself.
+func (inv *Inventory) Resolve() []*Host {
+	depth := make(map[string]int, len(inv.Groups))
+	var groupDepth func(name string) int
+	groupDepth = func(name string) int {
+		if d, ok := depth[name]; ok {
+			return d
+		}
+		d := 0
+		for parent, g := range inv.Groups {
+			if slices.Contains(g.Children, name) {
+				d = max(d, groupDepth(parent)+1)
+			}
+		}
+		depth[name] = d
+		return d
+	}
+
+	hosts := make([]*Host, 0, len(inv.Hosts))
+	for name, h := range inv.Hosts {
+		resolved := &Host{Name: name, Address: h.Address, Tags: h.Tags, Groups: inv.groupsOf(name)}
+		if resolved.Address == "" {
+			resolved.Address = name
+		}
+
+		groups := slices.Clone(resolved.Groups)
+		sort.SliceStable(groups, func(i, j int) bool { return groupDepth(groups[i]) < groupDepth(groups[j]) })
+		vars := inv.Defaults
+		for _, g := range groups {
+			vars = vars.merge(inv.Groups[g].Vars)
+		}
+		resolved.HostVars = vars.merge(h.HostVars)
+		hosts = append(hosts, resolved)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
+	return hosts
+}
+
+// Host returns the resolved host called name.
+func (inv *Inventory) Host(name string) (*Host, bool) {
+	if _, ok := inv.Hosts[name]; !ok {
+		return nil, false
+	}
+	for _, h := range inv.Resolve() {
+		if h.Name == name {
+			return h, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,103 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/babbage88/infra-cli/proxmox"
+)
+
+// ProxmoxSource configures hosts discovered from the Proxmox API. HostURL and ApiToken may instead
+// come from ConfigFile, the same file the proxmox commands take with --config-file. Vars apply to
+// every discovered host, after the inventory defaults. The TLS keys (ca_bundle, fingerprint,
+// insecure_skip_verify) sit beside host_url.
+//
+//	proxmox:
+//	  config_file: ~/.config/infractl/proxmox.yaml
+//	  fingerprint: AB:CD:...
+//	  vars: {user: root}
+type ProxmoxSource struct {
+	HostURL    string             `json:"hostUrl,omitempty" yaml:"host_url,omitempty"`
+	ApiToken   string             `json:"-" yaml:"api_token,omitempty"`
+	ConfigFile string             `json:"configFile,omitempty" yaml:"config_file,omitempty"`
+	TLS        proxmox.TLSOptions `json:"tls,omitempty" yaml:",inline"`
+	Vars       HostVars           `json:"vars,omitempty" yaml:"vars,omitempty"`
+}
+
+// Labels set on hosts discovered from Proxmox.
+const (
+	LabelPveNode   = "pve-node"
+	LabelPveVmId   = "pve-vmid"
+	LabelPveType   = "pve-type"
+	LabelPveStatus = "pve-status"
+)
+
+// ProxmoxHosts maps every container and VM in the cluster to a host named after the guest, with
+// its first IP address (IPv4 preferred) as the address, its Proxmox tags as tags and pve-* labels.
+func (inv *Inventory) ProxmoxHosts(ctx context.Context, client *proxmox.Client) ([]*Host, error) {
+	guests, err := client.ListGuests(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing Proxmox guests: %w", err)
+	}
+
+	vars := inv.Defaults
+	if inv.Proxmox != nil {
+		vars = vars.merge(inv.Proxmox.Vars)
+	}
+
+	hosts := make([]*Host, 0, len(guests))
+	for _, g := range guests {
+		h := &Host{
+			Name:    g.Name,
+			Address: g.Name,
+			Tags:    g.Tags,
+			PveTags: g.Tags,
+			HostVars: vars.merge(HostVars{Labels: map[string]string{
+				LabelPveNode:   g.Node,
+				LabelPveVmId:   strconv.Itoa(g.VmId),
+				LabelPveType:   g.Type,
+				LabelPveStatus: g.Status,
+			}}),
+		}
+		if h.Name == "" {
+			h.Name = strconv.Itoa(g.VmId)
+		}
+		if len(g.Addresses) > 0 {
+			h.Address = g.Addresses[0]
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+// MergeHosts adds discovered hosts to the static inventory hosts. A static host with the same
+// name keeps its address and vars and gains the discovered tags and labels.
+func MergeHosts(static, discovered []*Host) []*Host {
+	merged := slices.Clone(static)
+	for _, d := range discovered {
+		i := slices.IndexFunc(merged, func(h *Host) bool { return h.Name == d.Name })
+		if i < 0 {
+			merged = append(merged, d)
+			continue
+		}
+		h := *merged[i]
+		h.PveTags = d.PveTags
+		h.Tags = slices.Clone(h.Tags)
+		for _, t := range d.Tags {
+			if !slices.Contains(h.Tags, t) {
+				h.Tags = append(h.Tags, t)
+			}
+		}
+		labels := make(map[string]string, len(d.Labels))
+		for k, v := range d.Labels {
+			if k == LabelPveNode || k == LabelPveVmId || k == LabelPveType || k == LabelPveStatus {
+				labels[k] = v
+			}
+		}
+		h.HostVars = h.HostVars.merge(HostVars{Labels: labels})
+		merged[i] = &h
+	}
+	return merged
+}
@@ -0,0 +1,133 @@
+package inventory
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Selector picks hosts from an inventory. It is a comma separated list of terms of the form
+// [op]kind:value, where kind is host, group, tag or label (label:key or label:key=value) and a
+// bare value matches a host or group name. The pve-tag, pve-node and pve-type kinds match hosts
+// discovered from the Proxmox API by their Proxmox tags, node and guest type (lxc or qemu). Terms
+// without an operator add their hosts, & keeps only hosts that also match the term, and ! removes
+// matching hosts. Host names and values may be globs. When the first term is & or !, it starts
+// from every host. "all" or "*" select every host.
+//
+//	group:web,tag:prod        hosts in group web or tagged prod
+//	group:web,&tag:prod       hosts in group web that are tagged prod
+//	group:web,!host:web3      hosts in group web except web3
+type Selector struct {
+	terms []selectorTerm
+}
+
+type selectorTerm struct {
+	op    byte // '+', '&' or '!'
+	kind  string
+	value string
+}
+
+// selectorKinds are the term kinds understood by Match.
+var selectorKinds = []string{"host", "group", "tag", "label", "pve-tag", "pve-node", "pve-type"}
+
+// ParseSelector parses a target expression.
+func ParseSelector(expr string) (Selector, error) {
+	var sel Selector
+	for _, raw := range strings.Split(expr, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		t := selectorTerm{op: '+'}
+		if raw[0] == '&' || raw[0] == '!' {
+			t.op, raw = raw[0], raw[1:]
+		}
+		if kind, value, ok := strings.Cut(raw, ":"); ok {
+			t.kind, t.value = kind, value
+		} else {
+			t.value = raw
+		}
+		if t.kind != "" && !slices.Contains(selectorKinds, t.kind) {
+			return Selector{}, fmt.Errorf("unknown target kind %q in %q, expected one of %v", t.kind, raw, selectorKinds)
+		}
+		if t.value == "" {
+			return Selector{}, fmt.Errorf("empty value in target term %q", raw)
+		}
+		sel.terms = append(sel.terms, t)
+	}
+	if len(sel.terms) == 0 {
+		return Selector{}, fmt.Errorf("empty target expression")
+	}
+	return sel, nil
+}
+
+// UsesProxmox reports whether the selector has pve-* terms, so hosts must be discovered from the
+// Proxmox API before selecting.
+func (s Selector) UsesProxmox() bool {
+	return slices.ContainsFunc(s.terms, func(t selectorTerm) bool { return strings.HasPrefix(t.kind, "pve-") })
+}
+
+// Select returns the hosts matching the selector, in the order of hosts.
+func (s Selector) Select(hosts []*Host) []*Host {
+	selected := make(map[*Host]bool, len(hosts))
+	if s.terms[0].op != '+' {
+		for _, h := range hosts {
+			selected[h] = true
+		}
+	}
+	for _, t := range s.terms {
+		for _, h := range hosts {
+			match := t.matches(h)
+			switch t.op {
+			case '+':
+				selected[h] = selected[h] || match
+			case '&':
+				selected[h] = selected[h] && match
+			case '!':
+				selected[h] = selected[h] && !match
+			}
+		}
+	}
+
+	var out []*Host
+	for _, h := range hosts {
+		if selected[h] {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+func (t selectorTerm) matches(h *Host) bool {
+	if t.kind == "" && (t.value == "all" || t.value == "*") {
+		return true
+	}
+	switch t.kind {
+	case "host":
+		return glob(t.value, h.Name)
+	case "group":
+		return slices.ContainsFunc(h.Groups, func(g string) bool { return glob(t.value, g) })
+	case "tag":
+		return slices.ContainsFunc(h.Tags, func(tag string) bool { return glob(t.value, tag) })
+	case "pve-tag":
+		return slices.ContainsFunc(h.PveTags, func(tag string) bool { return glob(t.value, tag) })
+	case "pve-node":
+		node, ok := h.Labels[LabelPveNode]
+		return ok && glob(t.value, node)
+	case "pve-type":
+		kind, ok := h.Labels[LabelPveType]
+		return ok && glob(t.value, kind)
+	case "label":
+		key, value, hasValue := strings.Cut(t.value, "=")
+		got, ok := h.Labels[key]
+		return ok && (!hasValue || glob(value, got))
+	default:
+		return glob(t.value, h.Name) || slices.ContainsFunc(h.Groups, func(g string) bool { return glob(t.value, g) })
+	}
+}
+
+func glob(pattern, s string) bool {
+	ok, err := path.Match(pattern, s)
+	return err == nil && ok || pattern == s
+}
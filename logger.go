@@ -3,7 +3,8 @@ package main
 import (
 	"context"
 	"log/slog"
-	"os"
+
+	"github.com/babbage88/infra-cli/cmd"
 )
 
 // CustomHandler wraps another slog.Handler and modifies the time format
@@ -26,7 +27,7 @@ func configureDefaultLogger(level slog.Level) {
 	logLevel := &slog.LevelVar{}
 	logLevel.Set(level)
 
-	textHandler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+	textHandler := slog.NewTextHandler(cmd.LogWriter(), &slog.HandlerOptions{
 		Level: logLevel,
 	})
 
@@ -0,0 +1,94 @@
+package cloudflare_utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// RecordFQDN returns name as a fully qualified name in zone. Names already ending in the zone are
+// returned as is, so both "web1" and "web1.example.com" give web1.example.com.
+func RecordFQDN(name string, zoneName string) string {
+	name = strings.TrimSuffix(name, ".")
+	switch {
+	case name == "@":
+		return zoneName
+	case name == zoneName || strings.HasSuffix(name, "."+zoneName):
+		return name
+	}
+	return name + "." + zoneName
+}
+
+// ErrDnsRecordNotOwned is returned by UpsertDnsRecord when a record with the same name and type
+// exists but may not be replaced.
+var ErrDnsRecordNotOwned = errors.New("DNS record exists and is not owned by the caller")
+
+// UpsertDnsRecord creates the record in zoneName, or updates the existing record with the same
+// name and type when owned reports it may be replaced, so running it again for the same host is
+// safe. Records owned rejects are left alone and ErrDnsRecordNotOwned is returned.
+func UpsertDnsRecord(ctx context.Context, token string, zoneName string, params cloudflare.CreateDNSRecordParams, owned func(cloudflare.DNSRecord) bool) (cloudflare.DNSRecord, error) {
+	api, err := NewCloudflareAPIClient(token)
+	if err != nil {
+		return cloudflare.DNSRecord{}, err
+	}
+	zoneId, err := api.ZoneIDByName(zoneName)
+	if err != nil {
+		return cloudflare.DNSRecord{}, fmt.Errorf("error retrieving ZoneId for %s: %w", zoneName, err)
+	}
+	zone := cloudflare.ZoneIdentifier(zoneId)
+	params.Name = RecordFQDN(params.Name, zoneName)
+
+	existing, _, err := api.ListDNSRecords(ctx, zone, cloudflare.ListDNSRecordsParams{Name: params.Name, Type: params.Type})
+	if err != nil {
+		return cloudflare.DNSRecord{}, fmt.Errorf("error listing DNS records for %s: %w", params.Name, err)
+	}
+	if len(existing) == 0 {
+		return api.CreateDNSRecord(ctx, zone, params)
+	}
+	if !owned(existing[0]) {
+		return existing[0], fmt.Errorf("%w: %s %s -> %s", ErrDnsRecordNotOwned, existing[0].Type, existing[0].Name, existing[0].Content)
+	}
+	return api.UpdateDNSRecord(ctx, zone, cloudflare.UpdateDNSRecordParams{
+		ID:      existing[0].ID,
+		Type:    params.Type,
+		Name:    params.Name,
+		Content: params.Content,
+		TTL:     params.TTL,
+		Proxied: params.Proxied,
+		Comment: &params.Comment,
+	})
+}
+
+// DeleteDnsRecordsByName deletes the records named name in zoneName whose type is one of types and
+// that owned accepts, and returns how many were removed.
+func DeleteDnsRecordsByName(ctx context.Context, token string, zoneName string, name string, owned func(cloudflare.DNSRecord) bool, types ...string) (int, error) {
+	api, err := NewCloudflareAPIClient(token)
+	if err != nil {
+		return 0, err
+	}
+	zoneId, err := api.ZoneIDByName(zoneName)
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving ZoneId for %s: %w", zoneName, err)
+	}
+	zone := cloudflare.ZoneIdentifier(zoneId)
+
+	records, _, err := api.ListDNSRecords(ctx, zone, cloudflare.ListDNSRecordsParams{Name: RecordFQDN(name, zoneName)})
+	if err != nil {
+		return 0, fmt.Errorf("error listing DNS records for %s: %w", name, err)
+	}
+	deleted := 0
+	for _, record := range records {
+		if !slices.Contains(types, record.Type) || !owned(record) {
+			continue
+		}
+		if err := api.DeleteDNSRecord(ctx, zone, record.ID); err != nil {
+			return deleted, fmt.Errorf("error deleting DNS record %s %s: %w", record.Type, record.Name, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
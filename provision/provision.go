@@ -0,0 +1,199 @@
+// Package provision turns a freshly created host into a ready one by running a declared list of
+// steps over ssh: package installs, users, files and commands.
+package provision
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+const (
+	defaultUser        = "root"
+	defaultWaitTimeout = 5 * time.Minute
+	defaultUserUtils   = "remote_utils/bin/user-utils"
+)
+
+// Spec is a provisioning file.
+//
+//	wait_timeout: 3m
+//	steps:
+//	  - packages: [curl, git]
+//	  - user: {name: deploy, uid: 1001, sudo: nopasswd, authorized_key_files: [~/.ssh/id_ed25519.pub]}
+//	  - file: {path: /etc/motd, content: "managed by infractl\n"}
+//	  - command: systemctl enable --now ssh
+type Spec struct {
+	User        string `json:"user,omitempty" yaml:"user,omitempty"`                // SSH user, root by default
+	SshKey      string `json:"sshKey,omitempty" yaml:"ssh_key,omitempty"`           // Private key for an injected public key, the ssh_key config by default
+	WaitTimeout string `json:"waitTimeout,omitempty" yaml:"wait_timeout,omitempty"` // How long to wait for the host to boot and answer ssh
+	UserUtils   string `json:"userUtils,omitempty" yaml:"user_utils,omitempty"`     // Local user-utils binary, see make utils
+	Steps       []Step `json:"steps" yaml:"steps"`
+}
+
+// Step is one provisioning action. Exactly one of Packages, User, File or Command is set.
+type Step struct {
+	Name     string    `json:"name,omitempty" yaml:"name,omitempty"`
+	Packages []string  `json:"packages,omitempty" yaml:"packages,omitempty"` // Installed with apt-get, dnf, yum or apk
+	User     *UserStep `json:"user,omitempty" yaml:"user,omitempty"`
+	File     *FileStep `json:"file,omitempty" yaml:"file,omitempty"`
+	Command  string    `json:"command,omitempty" yaml:"command,omitempty"` // Run with sh -c
+}
+
+// UserStep creates a user with the bundled user-utils and installs their authorized keys.
+type UserStep struct {
+	Name               string   `json:"name" yaml:"name"`
+	Uid                int64    `json:"uid" yaml:"uid"`
+	Gid                int64    `json:"gid,omitempty" yaml:"gid,omitempty"`   // Defaults to the uid
+	Sudo               string   `json:"sudo,omitempty" yaml:"sudo,omitempty"` // all or nopasswd; needs sudo installed
+	AuthorizedKeys     []string `json:"authorizedKeys,omitempty" yaml:"authorized_keys,omitempty"`
+	AuthorizedKeyFiles []string `json:"authorizedKeyFiles,omitempty" yaml:"authorized_key_files,omitempty"`
+}
+
+// FileStep writes a file from inline Content or a local Src file.
+type FileStep struct {
+	Path    string `json:"path" yaml:"path"`
+	Content string `json:"content,omitempty" yaml:"content,omitempty"`
+	Src     string `json:"src,omitempty" yaml:"src,omitempty"`
+	Mode    string `json:"mode,omitempty" yaml:"mode,omitempty"`   // Octal, 0644 by default
+	Owner   string `json:"owner,omitempty" yaml:"owner,omitempty"` // user or user:group
+}
+
+// Load reads and validates a provisioning file. Relative Src paths are resolved against the
+// file's directory.
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading provisioning file: %w", err)
+	}
+	spec := &Spec{}
+	if err := yaml.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("error parsing provisioning file %s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for _, step := range spec.Steps {
+		if step.File != nil && step.File.Src != "" {
+			step.File.Src = resolvePath(dir, step.File.Src)
+		}
+		if step.User != nil {
+			for i, f := range step.User.AuthorizedKeyFiles {
+				step.User.AuthorizedKeyFiles[i] = resolvePath(dir, f)
+			}
+		}
+	}
+	if spec.UserUtils != "" {
+		spec.UserUtils = resolvePath(dir, spec.UserUtils)
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid provisioning file %s: %w", path, err)
+	}
+	return spec, nil
+}
+
+// resolvePath expands ~/ and makes relative paths relative to dir.
+func resolvePath(dir, p string) string {
+	if rest, ok := strings.CutPrefix(p, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(dir, p)
+}
+
+// Validate checks that every step sets exactly one action and has what that action needs.
+func (s *Spec) Validate() error {
+	if _, err := s.parseTimeout(); err != nil {
+		return err
+	}
+	for i, step := range s.Steps {
+		if err := step.validate(); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (step Step) validate() error {
+	actions := 0
+	for _, set := range []bool{len(step.Packages) > 0, step.User != nil, step.File != nil, step.Command != ""} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return fmt.Errorf("set exactly one of packages, user, file or command")
+	}
+
+	if u := step.User; u != nil {
+		if u.Name == "" || u.Uid <= 0 {
+			return fmt.Errorf("user needs a name and a uid")
+		}
+		if u.Sudo != "" && u.Sudo != "all" && u.Sudo != "nopasswd" {
+			return fmt.Errorf("user sudo must be all or nopasswd, got %q", u.Sudo)
+		}
+	}
+	if f := step.File; f != nil {
+		if !strings.HasPrefix(f.Path, "/") {
+			return fmt.Errorf("file path must be absolute")
+		}
+		if (f.Content == "") == (f.Src == "") {
+			return fmt.Errorf("file needs either content or src")
+		}
+		if f.Mode != "" {
+			if _, err := strconv.ParseUint(f.Mode, 8, 32); err != nil {
+				return fmt.Errorf("file mode %q is not octal", f.Mode)
+			}
+		}
+	}
+	return nil
+}
+
+// label describes the step in progress output.
+func (step Step) label() string {
+	if step.Name != "" {
+		return step.Name
+	}
+	switch {
+	case len(step.Packages) > 0:
+		return "install " + strings.Join(step.Packages, " ")
+	case step.User != nil:
+		return "user " + step.User.Name
+	case step.File != nil:
+		return "file " + step.File.Path
+	default:
+		return step.Command
+	}
+}
+
+// SshUser returns the user to connect as.
+func (s *Spec) SshUser() string {
+	if s.User == "" {
+		return defaultUser
+	}
+	return s.User
+}
+
+// Timeout returns how long to wait for the host to boot and answer ssh.
+func (s *Spec) Timeout() time.Duration {
+	timeout, _ := s.parseTimeout()
+	return timeout
+}
+
+func (s *Spec) parseTimeout() (time.Duration, error) {
+	if s.WaitTimeout == "" {
+		return defaultWaitTimeout, nil
+	}
+	timeout, err := time.ParseDuration(s.WaitTimeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid wait_timeout %q", s.WaitTimeout)
+	}
+	return timeout, nil
+}
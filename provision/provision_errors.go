@@ -0,0 +1,33 @@
+package provision
+
+import "fmt"
+
+// StepError is a provisioning step that failed on the host.
+type StepError struct {
+	Message string `json:"message"` // Human readable message for clients
+	Code    int    `json:"-"`       // HTTP Status code. We use `-` to skip json marshaling.
+	Step    int    `json:"step"`    // 1-based index into Spec.Steps
+	Name    string `json:"name"`
+	Output  string `json:"output,omitempty"` // Combined stdout and stderr of the failed command
+	Err     error  `json:"-"`                // The original error. Same reason as above.
+}
+
+func StepErrorWrapper(step int, name string, output string, err error) error {
+	return StepError{
+		Message: "provisioning step failed",
+		Code:    500,
+		Step:    step,
+		Name:    name,
+		Output:  output,
+		Err:     err,
+	}
+}
+
+// Implements the errors.Unwrap interface
+func (err StepError) Unwrap() error {
+	return err.Err
+}
+
+func (err StepError) Error() string {
+	return fmt.Sprintf("%s: step %d (%s): %v", err.Message, err.Step, err.Name, err.Err)
+}
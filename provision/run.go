@@ -0,0 +1,275 @@
+package provision
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/babbage88/infra-cli/ssh"
+)
+
+// WaitForSsh waits until addr (host:port) accepts TCP connections, giving up after timeout.
+func WaitForSsh(ctx context.Context, addr string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("ssh on %s did not come up within %s: %w", addr, timeout, err)
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// runner carries what the steps share while running on one host.
+type runner struct {
+	agent      *ssh.RemoteAppDeploymentAgent
+	out        io.Writer
+	sudo       bool // connected as a user other than root
+	userUtils  string
+	pkgManager string // detected on first use
+}
+
+// Run executes the steps in order on the host behind agent, printing progress to out, and stops at
+// the first failure with a StepError. Steps run through sudo unless the agent is connected as root.
+func (s *Spec) Run(ctx context.Context, agent *ssh.RemoteAppDeploymentAgent, out io.Writer) error {
+	r := &runner{
+		agent:     agent,
+		out:       out,
+		sudo:      agent.User != "root",
+		userUtils: s.UserUtils,
+	}
+	if r.userUtils == "" {
+		r.userUtils = defaultUserUtils
+	}
+
+	for i, step := range s.Steps {
+		fmt.Fprintf(out, "==> [%s] step %d/%d: %s\n", agent.Hostname, i+1, len(s.Steps), step.label())
+		var result *ssh.CommandResult
+		var err error
+		switch {
+		case len(step.Packages) > 0:
+			result, err = r.installPackages(ctx, step.Packages)
+		case step.User != nil:
+			result, err = r.createUser(ctx, step.User)
+		case step.File != nil:
+			result, err = r.writeFile(ctx, step.File)
+		default:
+			result, err = r.shell(ctx, step.Command)
+		}
+		if result != nil && result.Stdout != "" {
+			fmt.Fprint(out, result.Stdout)
+		}
+		if err == nil && result != nil && !result.Success() {
+			err = fmt.Errorf("exit status %d", result.ExitCode)
+		}
+		if err != nil {
+			output := ""
+			if result != nil {
+				output = strings.TrimSpace(result.Stdout + result.Stderr)
+			}
+			return StepErrorWrapper(i+1, step.label(), output, err)
+		}
+	}
+	return nil
+}
+
+// shell runs script with sh -c, through sudo when not connected as root.
+func (r *runner) shell(ctx context.Context, script string) (*ssh.CommandResult, error) {
+	args := []string{"-c", ssh.ShellQuote(script)}
+	if r.sudo {
+		return r.agent.RunSudoCommandWithResult(ctx, "sh", args)
+	}
+	return r.agent.RunCommandWithResult(ctx, "sh", args)
+}
+
+// detectPackageManager finds the first of apt-get, dnf, yum or apk on the host.
+func (r *runner) detectPackageManager(ctx context.Context) (string, error) {
+	if r.pkgManager != "" {
+		return r.pkgManager, nil
+	}
+	result, err := r.agent.RunCommandWithResult(ctx, "sh", []string{"-c", ssh.ShellQuote(
+		`for pm in apt-get dnf yum apk; do if command -v $pm >/dev/null 2>&1; then echo $pm; exit 0; fi; done; exit 1`)})
+	if err != nil || !result.Success() {
+		return "", fmt.Errorf("no supported package manager (apt-get, dnf, yum, apk) found on %s", r.agent.Hostname)
+	}
+	r.pkgManager = strings.TrimSpace(result.Stdout)
+	return r.pkgManager, nil
+}
+
+func (r *runner) installPackages(ctx context.Context, packages []string) (*ssh.CommandResult, error) {
+	pm, err := r.detectPackageManager(ctx)
+	if err != nil {
+		return nil, err
+	}
+	quoted := make([]string, len(packages))
+	for i, p := range packages {
+		quoted[i] = ssh.ShellQuote(p)
+	}
+	pkgs := strings.Join(quoted, " ")
+
+	var script string
+	switch pm {
+	case "apt-get":
+		script = "export DEBIAN_FRONTEND=noninteractive; apt-get update -q && apt-get install -y -q " + pkgs
+	case "apk":
+		script = "apk add --no-cache " + pkgs
+	default:
+		script = pm + " install -y " + pkgs
+	}
+	return r.shell(ctx, script)
+}
+
+// createUser creates the user with the bundled user-utils unless it already exists with the same
+// uid, then adds its authorized keys.
+func (r *runner) createUser(ctx context.Context, u *UserStep) (*ssh.CommandResult, error) {
+	existing, err := r.agent.RunCommandWithResult(ctx, "id", []string{"-u", ssh.ShellQuote(u.Name)})
+	if err != nil || strings.TrimSpace(existing.Stdout) != fmt.Sprint(u.Uid) {
+		utils, err := os.ReadFile(r.userUtils)
+		if err != nil {
+			return nil, fmt.Errorf("error reading user-utils, build it with make utils or set user_utils: %w", err)
+		}
+		remotePath, err := r.upload(ctx, utils, "/tmp/infractl-user-utils.XXXXXX")
+		if err != nil {
+			return nil, err
+		}
+		defer r.agent.RunCommandWithResult(ctx, "rm", []string{"-f", ssh.ShellQuote(remotePath)})
+
+		args := []string{"-username", ssh.ShellQuote(u.Name), "-uid", fmt.Sprint(u.Uid)}
+		if u.Gid != 0 {
+			args = append(args, "-gid", fmt.Sprint(u.Gid))
+		}
+		if u.Sudo != "" {
+			args = append(args, "-add-sudo", "-all-sudo")
+			if u.Sudo == "nopasswd" {
+				args = append(args, "-nopass-sudo")
+			}
+		}
+		result, err := r.run(ctx, remotePath, args)
+		if err != nil || !result.Success() {
+			return result, err
+		}
+	}
+
+	var keys []ssh.AuthorizedKey
+	for _, line := range u.AuthorizedKeys {
+		keys = append(keys, ssh.ParseAuthorizedKeyLine(line))
+	}
+	for _, file := range u.AuthorizedKeyFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading authorized key file: %w", err)
+		}
+		keys = append(keys, ssh.ParseAuthorizedKeys(data)...)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return r.addAuthorizedKeys(ctx, u.Name, keys)
+}
+
+// addAuthorizedKeys adds keys to user's authorized_keys. Connected as root or as user, the file is
+// replaced over sftp. Otherwise it is read and replaced through sudo like the other steps, since
+// the connected user cannot write another user's home.
+func (r *runner) addAuthorizedKeys(ctx context.Context, user string, keys []ssh.AuthorizedKey) (*ssh.CommandResult, error) {
+	if !r.sudo || user == r.agent.User {
+		current, err := r.agent.ReadAuthorizedKeys(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		return nil, r.agent.WriteAuthorizedKeys(ctx, user, ssh.DedupeAuthorizedKeys(append(current, keys...)))
+	}
+
+	home := fmt.Sprintf(`home=$(getent passwd %s | cut -d: -f6) && [ -n "$home" ] || { echo "user has no home directory" >&2; exit 1; }`,
+		ssh.ShellQuote(user))
+	current, err := r.shell(ctx, home+`; cat "$home/.ssh/authorized_keys" 2>/dev/null || true`)
+	if err != nil || !current.Success() {
+		return current, err
+	}
+	merged := ssh.DedupeAuthorizedKeys(append(ssh.ParseAuthorizedKeys([]byte(current.Stdout)), keys...))
+	tmp, err := r.upload(ctx, ssh.FormatAuthorizedKeys(merged), "/tmp/infractl-keys.XXXXXX")
+	if err != nil {
+		return nil, err
+	}
+	defer r.agent.RunCommandWithResult(ctx, "rm", []string{"-f", ssh.ShellQuote(tmp)})
+
+	// Install next to the old file and rename over it, so a failure never leaves it partial.
+	owner := fmt.Sprintf(`-o %s -g "$(id -g %s)"`, ssh.ShellQuote(user), ssh.ShellQuote(user))
+	return r.shell(ctx, strings.Join([]string{
+		"set -e",
+		home,
+		`install -d -m 0700 ` + owner + ` "$home/.ssh"`,
+		`install -m 0600 ` + owner + ` ` + ssh.ShellQuote(tmp) + ` "$home/.ssh/authorized_keys.infractl.tmp"`,
+		`mv -f "$home/.ssh/authorized_keys.infractl.tmp" "$home/.ssh/authorized_keys"`,
+	}, "\n"))
+}
+
+// writeFile uploads the file to a temp path and installs it with its mode and owner, creating
+// parent directories.
+func (r *runner) writeFile(ctx context.Context, f *FileStep) (*ssh.CommandResult, error) {
+	data := []byte(f.Content)
+	if f.Src != "" {
+		var err error
+		if data, err = os.ReadFile(f.Src); err != nil {
+			return nil, fmt.Errorf("error reading file source: %w", err)
+		}
+	}
+	tmp, err := r.upload(ctx, data, "/tmp/infractl-file.XXXXXX")
+	if err != nil {
+		return nil, err
+	}
+
+	mode := f.Mode
+	if mode == "" {
+		mode = "0644"
+	}
+	args := []string{"-D", "-m", ssh.ShellQuote(mode)}
+	if f.Owner != "" {
+		owner, group, _ := strings.Cut(f.Owner, ":")
+		args = append(args, "-o", ssh.ShellQuote(owner))
+		if group != "" {
+			args = append(args, "-g", ssh.ShellQuote(group))
+		}
+	}
+	args = append(args, ssh.ShellQuote(tmp), ssh.ShellQuote(path.Clean(f.Path)))
+	result, err := r.run(ctx, "install", args)
+	r.agent.RunCommandWithResult(ctx, "rm", []string{"-f", ssh.ShellQuote(tmp)})
+	return result, err
+}
+
+// run runs a command directly, through sudo when not connected as root.
+func (r *runner) run(ctx context.Context, cmd string, args []string) (*ssh.CommandResult, error) {
+	if r.sudo {
+		return r.agent.RunSudoCommandWithResult(ctx, cmd, args)
+	}
+	return r.agent.RunCommandWithResult(ctx, cmd, args)
+}
+
+// upload writes data to a new temp file made from template on the host and returns its path. The
+// file is only readable by the connected user.
+func (r *runner) upload(ctx context.Context, data []byte, template string) (string, error) {
+	tmp, err := r.agent.RunCommandWithResult(ctx, "mktemp", []string{template})
+	if err != nil {
+		return "", fmt.Errorf("error creating remote temp file: %w", err)
+	}
+	remotePath := strings.TrimSpace(tmp.Stdout)
+	if _, err := r.agent.WriteBytesSftp(remotePath, data); err != nil {
+		return "", err
+	}
+	if result, err := r.agent.RunCommandWithResult(ctx, "chmod", []string{"700", ssh.ShellQuote(remotePath)}); err != nil {
+		return "", fmt.Errorf("error setting remote temp file mode: %s", result.Stderr)
+	}
+	return remotePath, nil
+}
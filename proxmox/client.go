@@ -0,0 +1,169 @@
+package proxmox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRequestTimeout = 30 * time.Second
+	defaultPollInterval   = 2 * time.Second
+)
+
+// Client talks to the Proxmox VE API with an API token. Responses are decoded from the
+// {"data": ...} envelope Proxmox wraps every result in.
+type Client struct {
+	BaseURL      string        // e.g. "https://proxmox.example.com:8006"
+	ApiToken     string        // Format: "USER@REALM!TOKENID=SECRET"
+	HTTPClient   *http.Client  // Carries the TLS settings and request timeout
+	PollInterval time.Duration // How often WaitForTask checks the task status
+	TaskOutput   io.Writer     // When set, WaitForTask streams the task log here
+}
+
+type ClientOption func(c *Client)
+
+// NewClient returns a client for the cluster described by auth, verifying its certificate
+// according to auth.TLS.
+func NewClient(auth Auth, opts ...ClientOption) (*Client, error) {
+	tlsConfig, err := auth.TLS.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	c := &Client{
+		BaseURL:      strings.TrimSuffix(auth.Host, "/"),
+		ApiToken:     auth.ApiToken,
+		HTTPClient:   &http.Client{Timeout: defaultRequestTimeout, Transport: transport},
+		PollInterval: defaultPollInterval,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.HTTPClient = httpClient
+	}
+}
+
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.HTTPClient.Timeout = timeout
+	}
+}
+
+func WithPollInterval(interval time.Duration) ClientOption {
+	return func(c *Client) {
+		c.PollInterval = interval
+	}
+}
+
+func WithTaskOutput(w io.Writer) ClientOption {
+	return func(c *Client) {
+		c.TaskOutput = w
+	}
+}
+
+// Get calls GET path (relative to /api2/json) with query and decodes the data into out, which
+// may be nil.
+func (c *Client) Get(ctx context.Context, path string, query url.Values, out any) error {
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return c.do(ctx, http.MethodGet, path, nil, out)
+}
+
+// Post calls POST path with form encoded params and decodes the data into out.
+func (c *Client) Post(ctx context.Context, path string, params url.Values, out any) error {
+	return c.do(ctx, http.MethodPost, path, params, out)
+}
+
+// Put calls PUT path with form encoded params and decodes the data into out.
+func (c *Client) Put(ctx context.Context, path string, params url.Values, out any) error {
+	return c.do(ctx, http.MethodPut, path, params, out)
+}
+
+// Delete calls DELETE path with query and decodes the data into out.
+func (c *Client) Delete(ctx context.Context, path string, query url.Values, out any) error {
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return c.do(ctx, http.MethodDelete, path, nil, out)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, params url.Values, out any) error {
+	var body io.Reader
+	if params != nil {
+		body = strings.NewReader(params.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+"/api2/json"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "PVEAPIToken="+c.ApiToken)
+	if params != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	envelope := struct {
+		Data    json.RawMessage   `json:"data"`
+		Errors  map[string]string `json:"errors"`
+		Message string            `json:"message"`
+	}{}
+	decodeErr := json.Unmarshal(data, &envelope)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// Proxmox puts the reason in the status line, e.g. "500 CT 101 already exists".
+		message := strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprintf("%d", resp.StatusCode)))
+		if envelope.Message != "" {
+			message = strings.TrimSpace(envelope.Message)
+		}
+		return ApiErrorWrapper(resp.StatusCode, method, path, message, envelope.Errors)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("error decoding Proxmox response for %s %s: %w", method, path, decodeErr)
+	}
+	if out == nil || len(envelope.Data) == 0 || bytes.Equal(envelope.Data, []byte("null")) {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return fmt.Errorf("error decoding Proxmox response for %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// nodePath builds /nodes/{node}/... with the node escaped.
+func nodePath(node string, format string, a ...any) string {
+	return "/nodes/" + url.PathEscape(node) + fmt.Sprintf(format, a...)
+}
+
+// formValues converts parameters built by ToFormParams and friends into a form body.
+func formValues(params map[string]string) url.Values {
+	form := url.Values{}
+	for k, v := range params {
+		form.Set(k, v)
+	}
+	return form
+}
@@ -0,0 +1,221 @@
+package proxmox
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Guest is an LXC container or QEMU VM found anywhere in the cluster, with its resource usage at
+// the time it was listed.
+type Guest struct {
+	VmId      int      `json:"vmid"`
+	Name      string   `json:"name"`
+	Node      string   `json:"node"`
+	Type      string   `json:"type"` // lxc or qemu
+	Status    string   `json:"status"`
+	Template  bool     `json:"template,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
+	Cpu       float64  `json:"cpu"` // fraction of MaxCpu in use
+	MaxCpu    float64  `json:"maxcpu"`
+	Mem       int64    `json:"mem"` // bytes
+	MaxMem    int64    `json:"maxmem"`
+	Uptime    int64    `json:"uptime"` // seconds
+}
+
+// ClusterGuests returns every container, VM and template in the cluster without their addresses,
+// which is much faster than ListGuests.
+func (c *Client) ClusterGuests(ctx context.Context) ([]Guest, error) {
+	var resources []struct {
+		VmId     int     `json:"vmid"`
+		Name     string  `json:"name"`
+		Node     string  `json:"node"`
+		Type     string  `json:"type"`
+		Status   string  `json:"status"`
+		Tags     string  `json:"tags"`
+		Template int     `json:"template"`
+		Cpu      float64 `json:"cpu"`
+		MaxCpu   float64 `json:"maxcpu"`
+		Mem      int64   `json:"mem"`
+		MaxMem   int64   `json:"maxmem"`
+		Uptime   int64   `json:"uptime"`
+	}
+	if err := c.Get(ctx, "/cluster/resources", url.Values{"type": {"vm"}}, &resources); err != nil {
+		return nil, err
+	}
+
+	guests := make([]Guest, 0, len(resources))
+	for _, r := range resources {
+		guests = append(guests, Guest{
+			VmId: r.VmId, Name: r.Name, Node: r.Node, Type: r.Type, Status: r.Status,
+			Template: r.Template == 1, Tags: splitTags(r.Tags),
+			Cpu: r.Cpu, MaxCpu: r.MaxCpu, Mem: r.Mem, MaxMem: r.MaxMem, Uptime: r.Uptime,
+		})
+	}
+	sort.Slice(guests, func(i, j int) bool { return guests[i].VmId < guests[j].VmId })
+	return guests, nil
+}
+
+// FindGuest looks up a container, VM or template by VMID, or by name when ref is not a number.
+// Names must be unique in the cluster.
+func (c *Client) FindGuest(ctx context.Context, ref string) (Guest, error) {
+	guests, err := c.ClusterGuests(ctx)
+	if err != nil {
+		return Guest{}, err
+	}
+	var matches []Guest
+	for _, g := range guests {
+		if fmt.Sprint(g.VmId) == ref || g.Name == ref {
+			matches = append(matches, g)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Guest{}, fmt.Errorf("no container or VM %q in the cluster", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return Guest{}, fmt.Errorf("%d guests are named %q, use the VMID instead", len(matches), ref)
+	}
+}
+
+// guestAddressLookups is how many guests FillGuestAddresses looks up at once.
+const guestAddressLookups = 8
+
+// ListGuests returns every container and VM on all nodes with their tags and IP addresses. Addresses
+// come from the running guest (the LXC interfaces or the QEMU guest agent) and fall back to static
+// addresses in the network config.
+func (c *Client) ListGuests(ctx context.Context) ([]Guest, error) {
+	all, err := c.ClusterGuests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	guests := make([]Guest, 0, len(all))
+	for _, g := range all {
+		if !g.Template {
+			guests = append(guests, g)
+		}
+	}
+	c.FillGuestAddresses(ctx, guests)
+	return guests, nil
+}
+
+// FillGuestAddresses sets the Addresses of every guest as described for ListGuests, IPv4 first,
+// looking up a few guests at once. Filter ClusterGuests down first, since each lookup is a request
+// to the guest's node and, for VMs, its guest agent.
+func (c *Client) FillGuestAddresses(ctx context.Context, guests []Guest) {
+	sem := make(chan struct{}, guestAddressLookups)
+	var wg sync.WaitGroup
+	for i := range guests {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(g *Guest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			g.Addresses = c.GuestAddresses(ctx, *g)
+			// Prefer IPv4 for connecting.
+			sort.SliceStable(g.Addresses, func(i, j int) bool {
+				return net.ParseIP(g.Addresses[i]).To4() != nil && net.ParseIP(g.Addresses[j]).To4() == nil
+			})
+		}(&guests[i])
+	}
+	wg.Wait()
+}
+
+// splitTags splits Proxmox's tag list, which is separated by ; (or , and spaces on older versions).
+func splitTags(tags string) []string {
+	return strings.FieldsFunc(tags, func(r rune) bool { return r == ';' || r == ',' || r == ' ' })
+}
+
+// GuestAddresses returns the guest's IP addresses as described for ListGuests.
+func (c *Client) GuestAddresses(ctx context.Context, g Guest) []string {
+	base := nodePath(g.Node, "/%s/%d", g.Type, g.VmId)
+	var addrs []string
+
+	if g.Status == "running" {
+		switch g.Type {
+		case "lxc":
+			var ifaces []struct {
+				Inet  string `json:"inet"`
+				Inet6 string `json:"inet6"`
+			}
+			if c.Get(ctx, base+"/interfaces", nil, &ifaces) == nil {
+				for _, i := range ifaces {
+					addrs = appendAddress(addrs, i.Inet)
+					addrs = appendAddress(addrs, i.Inet6)
+				}
+			}
+		case "qemu":
+			var agent struct {
+				Result []struct {
+					IpAddresses []struct {
+						IpAddress string `json:"ip-address"`
+					} `json:"ip-addresses"`
+				} `json:"result"`
+			}
+			if c.Get(ctx, base+"/agent/network-get-interfaces", nil, &agent) == nil {
+				for _, i := range agent.Result {
+					for _, a := range i.IpAddresses {
+						addrs = appendAddress(addrs, a.IpAddress)
+					}
+				}
+			}
+		}
+	}
+	if len(addrs) > 0 {
+		return addrs
+	}
+
+	// Static addresses from net0=...,ip=10.0.0.5/24 (LXC) or ipconfig0=ip=10.0.0.5/24 (cloud-init).
+	config, err := c.GuestConfig(ctx, g)
+	if err != nil {
+		return nil
+	}
+	keys := make([]string, 0, len(config))
+	for k := range config {
+		if strings.HasPrefix(k, "net") || strings.HasPrefix(k, "ipconfig") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value, _ := config[k].(string)
+		for _, opt := range strings.Split(value, ",") {
+			if name, ip, ok := strings.Cut(opt, "="); ok && (name == "ip" || name == "ip6") {
+				addrs = appendAddress(addrs, ip)
+			}
+		}
+	}
+	return addrs
+}
+
+// appendAddress adds a usable address, dropping any /prefix, and skips dhcp, loopback and
+// link-local addresses.
+func appendAddress(addrs []string, addr string) []string {
+	addr, _, _ = strings.Cut(addr, "/")
+	ip := net.ParseIP(addr)
+	if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return addrs
+	}
+	for _, a := range addrs {
+		if a == addr {
+			return addrs
+		}
+	}
+	return append(addrs, addr)
+}
+
+// GuestConfig returns the guest's current configuration, e.g. net0, description and tags.
+func (c *Client) GuestConfig(ctx context.Context, g Guest) (map[string]any, error) {
+	var config map[string]any
+	if err := c.Get(ctx, nodePath(g.Node, "/%s/%d/config", g.Type, g.VmId), nil, &config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
@@ -1,44 +1,32 @@
 package proxmox
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
 	"net/url"
 	"strings"
+	"time"
 )
 
-func CreateLXCContainer(host, token, node string, params map[string]string) error {
-	apiURL := fmt.Sprintf("%s/api2/json/nodes/%s/lxc", host, node)
-
-	form := url.Values{}
-	for k, v := range params {
-		form.Set(k, v)
+// CreateLxc queues creation of a container on node and returns the task UPID. Use WaitForTask to
+// wait until the container exists.
+func (c *Client) CreateLxc(ctx context.Context, node string, params map[string]string) (string, error) {
+	var upid string
+	if err := c.Post(ctx, nodePath(node, "/lxc"), formValues(params), &upid); err != nil {
+		return "", err
 	}
+	slog.Info("Container creation queued", slog.String("node", node), slog.String("upid", upid))
+	return upid, nil
+}
 
-	req, err := http.NewRequest("POST", apiURL, strings.NewReader(form.Encode()))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Authorization", "PVEAPIToken="+token)
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
+// UpdateLxcConfig changes settings of an existing container, e.g. memory or net0. Keys listed in
+// params["delete"], separated by commas, are removed from the config.
+func (c *Client) UpdateLxcConfig(ctx context.Context, node string, vmid int, params map[string]string) error {
+	if err := c.Put(ctx, nodePath(node, "/lxc/%d/config", vmid), formValues(params), nil); err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	var buf bytes.Buffer
-	buf.ReadFrom(resp.Body)
-
-	if resp.StatusCode != 200 {
-		log.Printf("Proxmox API error: %s\nBody: %s", resp.Status, buf.String())
-		return fmt.Errorf("Proxmox API error: %s", resp.Status)
-	}
-
-	log.Println("Container created successfully")
+	slog.Info("Container config updated", slog.String("node", node), slog.Int("vmid", vmid))
 	return nil
 }
 
@@ -64,3 +52,114 @@ func (l *LxcContainer) ParseSshPublicKeySlice() (string, error) {
 	sshKeysParam.WriteString(lastSshKeyItem)
 	return sshKeysParam.String(), nil
 }
+
+// LxcStatus is the live state of a container from status/current.
+type LxcStatus struct {
+	Name    string  `json:"name"`
+	Status  string  `json:"status"` // running or stopped
+	Lock    string  `json:"lock,omitempty"`
+	Tags    string  `json:"tags,omitempty"`
+	Uptime  int64   `json:"uptime"`
+	Cpu     float64 `json:"cpu"`
+	Cpus    float64 `json:"cpus"`
+	Mem     int64   `json:"mem"`
+	MaxMem  int64   `json:"maxmem"`
+	Swap    int64   `json:"swap"`
+	MaxSwap int64   `json:"maxswap"`
+	Disk    int64   `json:"disk"`
+	MaxDisk int64   `json:"maxdisk"`
+}
+
+func (c *Client) LxcStatus(ctx context.Context, node string, vmid int) (*LxcStatus, error) {
+	status := &LxcStatus{}
+	if err := c.Get(ctx, nodePath(node, "/lxc/%d/status/current", vmid), nil, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// StartLxc, StopLxc, ShutdownLxc, RebootLxc and DeleteLxc queue the action and return the task
+// UPID. Use WaitForTask to wait for it to finish.
+
+func (c *Client) StartLxc(ctx context.Context, node string, vmid int) (string, error) {
+	return c.lxcStatusAction(ctx, node, vmid, "start", nil)
+}
+
+// StopLxc stops the container immediately, like pulling the plug.
+func (c *Client) StopLxc(ctx context.Context, node string, vmid int) (string, error) {
+	return c.lxcStatusAction(ctx, node, vmid, "stop", nil)
+}
+
+// ShutdownLxc asks the container's init to shut down. The task fails if the container is still
+// running after timeout.
+func (c *Client) ShutdownLxc(ctx context.Context, node string, vmid int, timeout time.Duration) (string, error) {
+	return c.lxcStatusAction(ctx, node, vmid, "shutdown", url.Values{"timeout": {timeoutSeconds(timeout)}})
+}
+
+// RebootLxc shuts the container down cleanly, waiting up to timeout, and starts it again.
+func (c *Client) RebootLxc(ctx context.Context, node string, vmid int, timeout time.Duration) (string, error) {
+	return c.lxcStatusAction(ctx, node, vmid, "reboot", url.Values{"timeout": {timeoutSeconds(timeout)}})
+}
+
+// DeleteLxc destroys a stopped container and its volumes. With purge it is also removed from
+// backup jobs, replication and HA.
+func (c *Client) DeleteLxc(ctx context.Context, node string, vmid int, purge bool) (string, error) {
+	query := url.Values{}
+	if purge {
+		query.Set("purge", "1")
+		query.Set("destroy-unreferenced-disks", "1")
+	}
+	var upid string
+	if err := c.Delete(ctx, nodePath(node, "/lxc/%d", vmid), query, &upid); err != nil {
+		return "", err
+	}
+	slog.Info("Container destroy queued", slog.String("node", node), slog.Int("vmid", vmid), slog.String("upid", upid))
+	return upid, nil
+}
+
+func (c *Client) lxcStatusAction(ctx context.Context, node string, vmid int, action string, params url.Values) (string, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+	var upid string
+	if err := c.Post(ctx, nodePath(node, "/lxc/%d/status/%s", vmid, action), params, &upid); err != nil {
+		return "", err
+	}
+	slog.Info("Container "+action+" queued", slog.String("node", node), slog.Int("vmid", vmid), slog.String("upid", upid))
+	return upid, nil
+}
+
+func timeoutSeconds(timeout time.Duration) string {
+	return fmt.Sprint(int(timeout.Round(time.Second).Seconds()))
+}
+
+// WaitForLxcAddress polls the running container's interfaces until it reports an IP address and
+// returns it, IPv4 preferred. It gives up after timeout.
+func (c *Client) WaitForLxcAddress(ctx context.Context, node string, vmid int, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		var ifaces []struct {
+			Inet  string `json:"inet"`
+			Inet6 string `json:"inet6"`
+		}
+		// The container may not answer while it is still booting, so errors are retried.
+		if err := c.Get(ctx, nodePath(node, "/lxc/%d/interfaces", vmid), nil, &ifaces); err == nil {
+			var v4, v6 []string
+			for _, i := range ifaces {
+				v4 = appendAddress(v4, i.Inet)
+				v6 = appendAddress(v6, i.Inet6)
+			}
+			if addrs := append(v4, v6...); len(addrs) > 0 {
+				return addrs[0], nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("container %d did not get an IP address within %s", vmid, timeout)
+		case <-time.After(c.PollInterval):
+		}
+	}
+}
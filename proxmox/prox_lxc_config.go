@@ -0,0 +1,312 @@
+package proxmox
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Proxmox limits on container network interfaces and mount points.
+const (
+	maxLxcNetworks    = 32
+	maxLxcMountPoints = 256
+)
+
+// LxcNetwork is one container network interface, sent as netN.
+type LxcNetwork struct {
+	Name     string  `json:"name,omitempty"`   // Interface name inside the container, defaults to ethN
+	Bridge   string  `json:"bridge,omitempty"` // Defaults to the container's Bridge
+	Ip       string  `json:"ip,omitempty"`     // CIDR, dhcp or manual
+	Gateway  string  `json:"gw,omitempty"`
+	Ip6      string  `json:"ip6,omitempty"` // CIDR, dhcp, auto or manual
+	Gateway6 string  `json:"gw6,omitempty"`
+	Hwaddr   string  `json:"hwaddr,omitempty"`
+	Tag      int     `json:"tag,omitempty"` // VLAN tag
+	Mtu      int     `json:"mtu,omitempty"`
+	Rate     float64 `json:"rate,omitempty"` // Rate limit in MB/s
+	Firewall bool    `json:"firewall,omitempty"`
+	Type     string  `json:"type,omitempty"` // Defaults to veth
+}
+
+// String formats the interface as a Proxmox property string, e.g.
+// name=eth0,bridge=vmbr0,ip=10.0.0.5/24,gw=10.0.0.1,type=veth.
+func (n LxcNetwork) String() string {
+	opts := []string{"name=" + n.Name, "bridge=" + n.Bridge}
+	if n.Firewall {
+		opts = append(opts, "firewall=1")
+	}
+	if n.Gateway != "" {
+		opts = append(opts, "gw="+n.Gateway)
+	}
+	if n.Gateway6 != "" {
+		opts = append(opts, "gw6="+n.Gateway6)
+	}
+	if n.Hwaddr != "" {
+		opts = append(opts, "hwaddr="+n.Hwaddr)
+	}
+	if n.Ip != "" {
+		opts = append(opts, "ip="+n.Ip)
+	}
+	if n.Ip6 != "" {
+		opts = append(opts, "ip6="+n.Ip6)
+	}
+	if n.Mtu != 0 {
+		opts = append(opts, fmt.Sprintf("mtu=%d", n.Mtu))
+	}
+	if n.Rate != 0 {
+		opts = append(opts, "rate="+strconv.FormatFloat(n.Rate, 'f', -1, 64))
+	}
+	if n.Tag != 0 {
+		opts = append(opts, fmt.Sprintf("tag=%d", n.Tag))
+	}
+	opts = append(opts, "type="+n.Type)
+	return strings.Join(opts, ",")
+}
+
+// LxcMountPoint is an extra container volume, sent as mpN. Either Storage and Size allocate a
+// new volume, or Volume names an existing volume or a host directory to bind mount.
+type LxcMountPoint struct {
+	Path         string   `json:"mp"`                // Mount path inside the container
+	Storage      string   `json:"storage,omitempty"` // Storage for a new volume
+	Size         DiskSize `json:"size,omitempty"`    // Size of a new volume in GB, e.g. 8 or 8G
+	Volume       string   `json:"volume,omitempty"`  // Existing volume (local-lvm:vm-101-disk-1) or host path
+	Backup       bool     `json:"backup,omitempty"`
+	ReadOnly     bool     `json:"ro,omitempty"`
+	Shared       bool     `json:"shared,omitempty"`
+	Quota        bool     `json:"quota,omitempty"`
+	NoReplicate  bool     `json:"noReplicate,omitempty"`
+	MountOptions string   `json:"mountoptions,omitempty"` // e.g. noatime;nosuid
+}
+
+// String formats the mount point as a Proxmox property string, e.g. local-lvm:8,mp=/data,backup=1.
+func (m LxcMountPoint) String() string {
+	volume := m.Volume
+	if volume == "" {
+		volume = m.Storage + ":" + m.Size.GB()
+	}
+	opts := []string{volume, "mp=" + m.Path}
+	if m.Backup {
+		opts = append(opts, "backup=1")
+	}
+	if m.ReadOnly {
+		opts = append(opts, "ro=1")
+	}
+	if m.Shared {
+		opts = append(opts, "shared=1")
+	}
+	if m.Quota {
+		opts = append(opts, "quota=1")
+	}
+	if m.NoReplicate {
+		opts = append(opts, "replicate=0")
+	}
+	if m.MountOptions != "" {
+		opts = append(opts, "mountoptions="+m.MountOptions)
+	}
+	return strings.Join(opts, ",")
+}
+
+// networks returns the container's interfaces with the defaults filled in. A container with no
+// Net0 or Networks but a Bridge gets a single DHCP interface on it.
+func (lxc *LxcContainer) networks() []LxcNetwork {
+	nets := lxc.Networks
+	if len(nets) == 0 && lxc.Net0 == "" && lxc.Bridge != "" {
+		nets = []LxcNetwork{{Ip: "dhcp"}}
+	}
+	out := make([]LxcNetwork, len(nets))
+	for i, n := range nets {
+		if n.Name == "" {
+			n.Name = fmt.Sprintf("eth%d", i)
+		}
+		if n.Bridge == "" {
+			n.Bridge = lxc.Bridge
+		}
+		if n.Type == "" {
+			n.Type = "veth"
+		}
+		out[i] = n
+	}
+	return out
+}
+
+var (
+	lxcHostnameRegex  = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+	lxcIfaceNameRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.-]{0,15}$`)
+)
+
+// Validate checks the container for missing required fields and combinations Proxmox would reject,
+// returning every problem found at once.
+func (lxc *LxcContainer) Validate() error {
+	var problems []string
+	fail := func(format string, a ...any) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	if lxc.Node == "" {
+		fail("node is required")
+	}
+	if lxc.VmId != 0 && (lxc.VmId < 100 || lxc.VmId > maxVmId) {
+		fail("vmid %d is out of range, must be between 100 and %d", lxc.VmId, maxVmId)
+	}
+	if lxc.OsTemplate == "" {
+		fail("ostemplate is required")
+	}
+	if lxc.Hostname != "" && (len(lxc.Hostname) > 253 || !lxcHostnameRegex.MatchString(lxc.Hostname)) {
+		fail("hostname %q is not a valid DNS name", lxc.Hostname)
+	}
+	if lxc.RootFsSize != "" && lxc.Storage == "" {
+		fail("rootfs size needs a storage")
+	}
+	if lxc.Memory < 0 || lxc.Swap < 0 || lxc.Cores < 0 || lxc.CpuLimit < 0 || lxc.CpuUnits < 0 || lxc.BwLimit < 0 {
+		fail("memory, swap, cores, cpulimit, cpuunits and bwlimit cannot be negative")
+	}
+	if lxc.Unprivileged == "0" && strings.Contains(lxc.Features, "keyctl=1") {
+		fail("the keyctl feature is only available to unprivileged containers")
+	}
+	if lxc.Debug != 0 && lxc.Debug != 1 {
+		fail("debug must be 0 or 1")
+	}
+	for _, ns := range strings.Fields(strings.ReplaceAll(lxc.Nameserver, ",", " ")) {
+		if net.ParseIP(ns) == nil {
+			fail("nameserver %q is not an IP address", ns)
+		}
+	}
+
+	if lxc.Net0 != "" && len(lxc.Networks) > 0 {
+		fail("set either net0 or networks, not both")
+	}
+	nets := lxc.networks()
+	if len(nets) > maxLxcNetworks {
+		fail("at most %d network interfaces are supported", maxLxcNetworks)
+	}
+	names := make(map[string]bool)
+	for i, n := range nets {
+		if !lxcIfaceNameRegex.MatchString(n.Name) {
+			fail("net%d: invalid interface name %q", i, n.Name)
+		}
+		if names[n.Name] {
+			fail("net%d: interface name %s is used more than once", i, n.Name)
+		}
+		names[n.Name] = true
+		if n.Bridge == "" {
+			fail("net%d: bridge is required", i)
+		}
+		if err := validateLxcIp(n.Ip, n.Gateway, false); err != nil {
+			fail("net%d: %v", i, err)
+		}
+		if err := validateLxcIp(n.Ip6, n.Gateway6, true); err != nil {
+			fail("net%d: %v", i, err)
+		}
+		if n.Hwaddr != "" {
+			if _, err := net.ParseMAC(n.Hwaddr); err != nil {
+				fail("net%d: invalid hwaddr %q", i, n.Hwaddr)
+			}
+		}
+		if n.Tag < 0 || n.Tag > 4094 {
+			fail("net%d: VLAN tag %d is out of range 1-4094", i, n.Tag)
+		}
+		if n.Mtu != 0 && (n.Mtu < 64 || n.Mtu > 65535) {
+			fail("net%d: mtu %d is out of range 64-65535", i, n.Mtu)
+		}
+		if n.Type != "veth" {
+			fail("net%d: unsupported interface type %q", i, n.Type)
+		}
+	}
+
+	if len(lxc.MountPoints) > maxLxcMountPoints {
+		fail("at most %d mount points are supported", maxLxcMountPoints)
+	}
+	paths := make(map[string]bool)
+	for i, m := range lxc.MountPoints {
+		switch {
+		case m.Path == "" || !path.IsAbs(m.Path):
+			fail("mp%d: mount path must be absolute", i)
+		case m.Path == "/":
+			fail("mp%d: cannot mount over the root filesystem", i)
+		case paths[path.Clean(m.Path)]:
+			fail("mp%d: %s is mounted more than once", i, m.Path)
+		}
+		paths[path.Clean(m.Path)] = true
+
+		switch {
+		case m.Volume != "" && (m.Storage != "" || m.Size != ""):
+			fail("mp%d: set either volume or storage and size, not both", i)
+		case m.Volume == "" && (m.Storage == "" || m.Size == ""):
+			fail("mp%d: a new volume needs storage and size", i)
+		case m.Size != "" && !isLxcDiskSize(m.Size):
+			fail("mp%d: invalid size %q, expected a number of GB such as 8 or 8G", i, m.Size)
+		}
+		if strings.HasPrefix(m.Volume, "/") && m.Backup {
+			fail("mp%d: bind mounts cannot be backed up", i)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid container %s: %s", lxc.Hostname, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateLxcIp checks an ip or ip6 setting and its gateway, which needs a static address.
+func validateLxcIp(ip, gateway string, v6 bool) error {
+	switch ip {
+	case "", "dhcp", "manual":
+	case "auto":
+		if !v6 {
+			return fmt.Errorf("ip auto is only valid for ip6")
+		}
+	default:
+		addr, _, err := net.ParseCIDR(ip)
+		if err != nil || (addr.To4() == nil) != v6 {
+			return fmt.Errorf("invalid address %q, expected CIDR notation such as 10.0.0.5/24", ip)
+		}
+	}
+	if gateway == "" {
+		return nil
+	}
+	if _, _, err := net.ParseCIDR(ip); err != nil {
+		return fmt.Errorf("gateway %s needs a static address", gateway)
+	}
+	if gw := net.ParseIP(gateway); gw == nil || (gw.To4() == nil) != v6 {
+		return fmt.Errorf("invalid gateway %q", gateway)
+	}
+	return nil
+}
+
+// DiskSize is a disk size from a config file, where it may be written as a number (8) or a
+// string ("8", "32G"). New volumes take a number of GB, so a G suffix is dropped when sending.
+type DiskSize string
+
+// GB returns the size as a number of GB without the G suffix, as new volumes are allocated.
+func (s DiskSize) GB() string {
+	return strings.TrimSuffix(strings.TrimSuffix(string(s), "G"), "g")
+}
+
+func (s *DiskSize) UnmarshalJSON(data []byte) error {
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err == nil {
+		*s = DiskSize(n)
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("invalid disk size %s", data)
+	}
+	*s = DiskSize(str)
+	return nil
+}
+
+// UnmarshalYAML accepts the same forms for batch files read with go-yaml.
+func (s *DiskSize) UnmarshalYAML(data []byte) error {
+	*s = DiskSize(strings.Trim(strings.TrimSpace(string(data)), `"'`))
+	return nil
+}
+
+func isLxcDiskSize(size DiskSize) bool {
+	n, err := strconv.ParseFloat(size.GB(), 64)
+	return err == nil && n > 0
+}
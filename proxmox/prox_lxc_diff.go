@@ -0,0 +1,152 @@
+package proxmox
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lxcMutableKeys are the settings Diff compares, the ones that can be changed on an existing
+// container. netN keys are compared as well.
+var lxcMutableKeys = []string{
+	"hostname", "memory", "swap", "cores", "cpulimit", "cpuunits",
+	"nameserver", "searchdomain", "description", "tags", "startup",
+}
+
+// LxcChange is a setting whose value in the container's config differs from the desired one. An
+// empty Desired means the setting is removed.
+type LxcChange struct {
+	Key     string `json:"key"`
+	Current string `json:"current"`
+	Desired string `json:"desired"`
+}
+
+func (c LxcChange) String() string {
+	switch {
+	case c.Desired == "":
+		return fmt.Sprintf("%s: remove %s", c.Key, c.Current)
+	case c.Current == "":
+		return fmt.Sprintf("%s: add %s", c.Key, c.Desired)
+	}
+	return fmt.Sprintf("%s: %s -> %s", c.Key, c.Current, c.Desired)
+}
+
+// Diff compares the container's mutable settings with config, the current config of the existing
+// container from GuestConfig, and returns what has to change. Settings left empty in lxc are not
+// compared. When lxc sets its networks, interfaces the container has beyond them are removed.
+func (lxc *LxcContainer) Diff(config map[string]any) []LxcChange {
+	desired := lxc.ToFormParams()
+	var changes []LxcChange
+
+	for _, key := range lxcMutableKeys {
+		want, ok := desired[key]
+		if !ok {
+			continue
+		}
+		have := configString(config[key])
+		if !sameLxcValue(key, have, want) {
+			changes = append(changes, LxcChange{Key: key, Current: have, Desired: want})
+		}
+	}
+
+	var netKeys []string
+	for key := range desired {
+		if isLxcNetKey(key) {
+			netKeys = append(netKeys, key)
+		}
+	}
+	if len(netKeys) == 0 {
+		return changes
+	}
+	for key := range config {
+		if isLxcNetKey(key) && !slices.Contains(netKeys, key) {
+			netKeys = append(netKeys, key)
+		}
+	}
+	sort.Strings(netKeys)
+	for _, key := range netKeys {
+		have, want := configString(config[key]), desired[key]
+		if !sameLxcValue(key, have, want) {
+			changes = append(changes, LxcChange{Key: key, Current: have, Desired: want})
+		}
+	}
+	return changes
+}
+
+// LxcChangeParams returns the UpdateLxcConfig parameters that apply changes.
+func LxcChangeParams(changes []LxcChange) map[string]string {
+	params := make(map[string]string)
+	var remove []string
+	for _, c := range changes {
+		if c.Desired == "" {
+			remove = append(remove, c.Key)
+			continue
+		}
+		params[c.Key] = c.Desired
+	}
+	if len(remove) > 0 {
+		params["delete"] = strings.Join(remove, ",")
+	}
+	return params
+}
+
+func isLxcNetKey(key string) bool {
+	n, ok := strings.CutPrefix(key, "net")
+	if !ok {
+		return false
+	}
+	_, err := strconv.Atoi(n)
+	return err == nil
+}
+
+// configString formats a value decoded from a JSON config the way it is sent back.
+func configString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// sameLxcValue compares a current and desired setting, ignoring what Proxmox normalizes: tag
+// order, trailing whitespace in descriptions and, for interfaces, options the container gained
+// that were not asked for, such as a generated hwaddr.
+func sameLxcValue(key, have, want string) bool {
+	switch {
+	case key == "tags":
+		a, b := splitTags(have), splitTags(want)
+		sort.Strings(a)
+		sort.Strings(b)
+		return slices.Equal(a, b)
+	case key == "description":
+		return strings.TrimSpace(have) == strings.TrimSpace(want)
+	case isLxcNetKey(key):
+		if have == "" || want == "" {
+			return have == want
+		}
+		current := propertyMap(have)
+		for k, v := range propertyMap(want) {
+			if current[k] != v {
+				return false
+			}
+		}
+		return true
+	}
+	return have == want
+}
+
+// propertyMap splits a Proxmox property string such as name=eth0,bridge=vmbr0 into its options.
+func propertyMap(value string) map[string]string {
+	props := make(map[string]string)
+	for _, opt := range strings.Split(value, ",") {
+		k, v, _ := strings.Cut(opt, "=")
+		props[k] = v
+	}
+	return props
+}
@@ -0,0 +1,140 @@
+package proxmox
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLxcContainerDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		lxc    LxcContainer
+		config map[string]any
+		want   []LxcChange
+	}{
+		{
+			name:   "unchanged",
+			lxc:    LxcContainer{Hostname: "web1", Memory: 1024, Cores: 2},
+			config: map[string]any{"hostname": "web1", "memory": float64(1024), "cores": float64(2)},
+		},
+		{
+			name:   "unset settings are not compared",
+			lxc:    LxcContainer{Hostname: "web1"},
+			config: map[string]any{"hostname": "web1", "memory": float64(512), "description": "hand written"},
+		},
+		{
+			name:   "changed settings",
+			lxc:    LxcContainer{Hostname: "web2", Memory: 2048},
+			config: map[string]any{"hostname": "web1", "memory": float64(1024)},
+			want: []LxcChange{
+				{Key: "hostname", Current: "web1", Desired: "web2"},
+				{Key: "memory", Current: "1024", Desired: "2048"},
+			},
+		},
+		{
+			name:   "missing setting is added",
+			lxc:    LxcContainer{Nameserver: "10.0.0.1"},
+			config: map[string]any{},
+			want:   []LxcChange{{Key: "nameserver", Current: "", Desired: "10.0.0.1"}},
+		},
+		{
+			name:   "create-only settings are ignored",
+			lxc:    LxcContainer{OsTemplate: "local:vztmpl/debian.tar.zst", Storage: "local-lvm", RootFsSize: "8", Pool: "dev"},
+			config: map[string]any{"rootfs": "local-lvm:vm-101-disk-0,size=4G"},
+		},
+		{
+			name: "network subset of current options",
+			lxc:  LxcContainer{Networks: []LxcNetwork{{Bridge: "vmbr0", Ip: "dhcp"}}},
+			config: map[string]any{
+				"net0": "name=eth0,bridge=vmbr0,hwaddr=BC:24:11:00:00:01,ip=dhcp,type=veth",
+			},
+		},
+		{
+			name: "network option changed",
+			lxc:  LxcContainer{Networks: []LxcNetwork{{Bridge: "vmbr0", Ip: "dhcp", Tag: 20}}},
+			config: map[string]any{
+				"net0": "name=eth0,bridge=vmbr0,hwaddr=BC:24:11:00:00:01,ip=dhcp,type=veth",
+			},
+			want: []LxcChange{{
+				Key:     "net0",
+				Current: "name=eth0,bridge=vmbr0,hwaddr=BC:24:11:00:00:01,ip=dhcp,type=veth",
+				Desired: "name=eth0,bridge=vmbr0,ip=dhcp,tag=20,type=veth",
+			}},
+		},
+		{
+			name: "extra interfaces are removed when networks are set",
+			lxc:  LxcContainer{Networks: []LxcNetwork{{Bridge: "vmbr0", Ip: "dhcp"}}},
+			config: map[string]any{
+				"net0": "name=eth0,bridge=vmbr0,ip=dhcp,type=veth",
+				"net1": "name=eth1,bridge=vmbr1,ip=dhcp,type=veth",
+			},
+			want: []LxcChange{{Key: "net1", Current: "name=eth1,bridge=vmbr1,ip=dhcp,type=veth", Desired: ""}},
+		},
+		{
+			name:   "interfaces are kept when networks are not set",
+			lxc:    LxcContainer{Hostname: "web1"},
+			config: map[string]any{"hostname": "web1", "net0": "name=eth0,bridge=vmbr0,ip=dhcp,type=veth"},
+		},
+		{
+			name:   "tags in another order",
+			lxc:    LxcContainer{Tags: "web;infractl-managed"},
+			config: map[string]any{"tags": "infractl-managed;web"},
+		},
+		{
+			name:   "tag added",
+			lxc:    LxcContainer{Tags: "web;infractl-managed"},
+			config: map[string]any{"tags": "web"},
+			want:   []LxcChange{{Key: "tags", Current: "web", Desired: "web;infractl-managed"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.lxc.Diff(tt.config)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameLxcValue(t *testing.T) {
+	tests := []struct {
+		key, have, want string
+		same            bool
+	}{
+		{"memory", "1024", "1024", true},
+		{"memory", "1024", "2048", false},
+		{"hostname", "web1", "Web1", false},
+		{"tags", "a;b;c", "c;a;b", true},
+		{"tags", "a,b", "a;b", true},
+		{"tags", "a;b", "a", false},
+		{"tags", "", "a", false},
+		{"description", "database\n", "database", true},
+		{"description", "database", "web", false},
+		{"net0", "name=eth0,bridge=vmbr0,hwaddr=BC:24:11:00:00:01,type=veth", "name=eth0,bridge=vmbr0,type=veth", true},
+		{"net0", "name=eth0,bridge=vmbr0,type=veth", "name=eth0,bridge=vmbr1,type=veth", false},
+		{"net0", "name=eth0,bridge=vmbr0,type=veth", "name=eth0,bridge=vmbr0,tag=20,type=veth", false},
+		{"net1", "name=eth1,bridge=vmbr0,type=veth", "", false},
+		{"net1", "", "name=eth1,bridge=vmbr0,type=veth", false},
+		{"net1", "", "", true},
+	}
+
+	for _, tt := range tests {
+		if got := sameLxcValue(tt.key, tt.have, tt.want); got != tt.same {
+			t.Errorf("sameLxcValue(%q, %q, %q) = %v, want %v", tt.key, tt.have, tt.want, got, tt.same)
+		}
+	}
+}
+
+func TestLxcChangeParams(t *testing.T) {
+	got := LxcChangeParams([]LxcChange{
+		{Key: "memory", Current: "1024", Desired: "2048"},
+		{Key: "net1", Current: "name=eth1,bridge=vmbr1", Desired: ""},
+		{Key: "net2", Current: "name=eth2,bridge=vmbr2", Desired: ""},
+	})
+	want := map[string]string{"memory": "2048", "delete": "net1,net2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LxcChangeParams() = %v, want %v", got, want)
+	}
+}
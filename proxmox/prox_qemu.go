@@ -0,0 +1,134 @@
+package proxmox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+)
+
+// CloneVm queues a clone of the VM or template templateId on node and returns the task UPID.
+// params carries newid and the optional name, target, full, storage, pool and description, see
+// QemuVm.CloneParams.
+func (c *Client) CloneVm(ctx context.Context, node string, templateId int, params map[string]string) (string, error) {
+	var upid string
+	if err := c.Post(ctx, nodePath(node, "/qemu/%d/clone", templateId), formValues(params), &upid); err != nil {
+		return "", err
+	}
+	slog.Info("VM clone queued", slog.String("node", node), slog.Int("template", templateId), slog.String("upid", upid))
+	return upid, nil
+}
+
+// UpdateVmConfig changes the VM's configuration, e.g. cores, net0 or ipconfig0. Proxmox may
+// apply the change in a task, in which case its UPID is returned, otherwise the UPID is empty.
+func (c *Client) UpdateVmConfig(ctx context.Context, node string, vmid int, params map[string]string) (string, error) {
+	var upid string
+	if err := c.Post(ctx, nodePath(node, "/qemu/%d/config", vmid), formValues(params), &upid); err != nil {
+		return "", err
+	}
+	return upid, nil
+}
+
+// ResizeVmDisk grows disk (e.g. scsi0) to size, such as 32G, or by size when it starts with +.
+// Newer Proxmox versions resize in a task and return its UPID, older ones return an empty UPID.
+func (c *Client) ResizeVmDisk(ctx context.Context, node string, vmid int, disk string, size string) (string, error) {
+	var upid string
+	params := url.Values{"disk": {disk}, "size": {size}}
+	if err := c.Put(ctx, nodePath(node, "/qemu/%d/resize", vmid), params, &upid); err != nil {
+		return "", err
+	}
+	return upid, nil
+}
+
+// StartVm, StopVm, ShutdownVm, RebootVm and DeleteVm queue the action and return the task UPID.
+// Use WaitForTask to wait for it to finish.
+
+func (c *Client) StartVm(ctx context.Context, node string, vmid int) (string, error) {
+	return c.vmStatusAction(ctx, node, vmid, "start", nil)
+}
+
+// StopVm stops the VM immediately, like pulling the plug.
+func (c *Client) StopVm(ctx context.Context, node string, vmid int) (string, error) {
+	return c.vmStatusAction(ctx, node, vmid, "stop", nil)
+}
+
+// ShutdownVm sends an ACPI shutdown, or asks the guest agent when it is enabled. The task fails
+// if the VM is still running after timeout.
+func (c *Client) ShutdownVm(ctx context.Context, node string, vmid int, timeout time.Duration) (string, error) {
+	return c.vmStatusAction(ctx, node, vmid, "shutdown", url.Values{"timeout": {timeoutSeconds(timeout)}})
+}
+
+// RebootVm shuts the VM down cleanly, waiting up to timeout, and starts it again.
+func (c *Client) RebootVm(ctx context.Context, node string, vmid int, timeout time.Duration) (string, error) {
+	return c.vmStatusAction(ctx, node, vmid, "reboot", url.Values{"timeout": {timeoutSeconds(timeout)}})
+}
+
+// DeleteVm destroys a stopped VM and its disks. With purge it is also removed from backup jobs,
+// replication and HA.
+func (c *Client) DeleteVm(ctx context.Context, node string, vmid int, purge bool) (string, error) {
+	query := url.Values{}
+	if purge {
+		query.Set("purge", "1")
+		query.Set("destroy-unreferenced-disks", "1")
+	}
+	var upid string
+	if err := c.Delete(ctx, nodePath(node, "/qemu/%d", vmid), query, &upid); err != nil {
+		return "", err
+	}
+	slog.Info("VM destroy queued", slog.String("node", node), slog.Int("vmid", vmid), slog.String("upid", upid))
+	return upid, nil
+}
+
+func (c *Client) vmStatusAction(ctx context.Context, node string, vmid int, action string, params url.Values) (string, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+	var upid string
+	if err := c.Post(ctx, nodePath(node, "/qemu/%d/status/%s", vmid, action), params, &upid); err != nil {
+		return "", err
+	}
+	slog.Info("VM "+action+" queued", slog.String("node", node), slog.Int("vmid", vmid), slog.String("upid", upid))
+	return upid, nil
+}
+
+// WaitForVmAddress polls the QEMU guest agent until the VM reports an IP address, preferring
+// IPv4, or gives up after timeout. The agent must be enabled in the VM config and installed in
+// the guest.
+func (c *Client) WaitForVmAddress(ctx context.Context, node string, vmid int, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		var agent struct {
+			Result []struct {
+				IpAddresses []struct {
+					IpAddress string `json:"ip-address"`
+					Type      string `json:"ip-address-type"` // ipv4 or ipv6
+				} `json:"ip-addresses"`
+			} `json:"result"`
+		}
+		// The agent does not answer until the guest has booted and started it, so errors are retried.
+		if err := c.Get(ctx, nodePath(node, "/qemu/%d/agent/network-get-interfaces", vmid), nil, &agent); err == nil {
+			var v4, v6 []string
+			for _, i := range agent.Result {
+				for _, a := range i.IpAddresses {
+					if a.Type == "ipv6" {
+						v6 = appendAddress(v6, a.IpAddress)
+					} else {
+						v4 = appendAddress(v4, a.IpAddress)
+					}
+				}
+			}
+			if addrs := append(v4, v6...); len(addrs) > 0 {
+				return addrs[0], nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("VM %d did not report an IP address through the guest agent within %s", vmid, timeout)
+		case <-time.After(c.PollInterval):
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package proxmox
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Proxmox limit on VM network interfaces.
+const maxVmNetworks = 32
+
+// QemuVm is a VM cloned from a template and then configured, including cloud-init. Zero values
+// keep whatever the template has.
+type QemuVm struct {
+	Node        string         `json:"node,omitempty"`     // Node to create the VM on, defaults to the template's node
+	VmId        int            `json:"vmid,omitempty"`     // Required
+	Name        string         `json:"name,omitempty"`     // VM name, also the cloud-init hostname
+	Template    string         `json:"template,omitempty"` // Required, VMID or name of the template to clone
+	FullClone   bool           `json:"full,omitempty"`     // Full copy instead of a linked clone
+	Storage     string         `json:"storage,omitempty"`  // Target storage for a full clone
+	Pool        string         `json:"pool,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Tags        string         `json:"tags,omitempty"`    // Semicolon separated tags
+	Cores       int            `json:"cores,omitempty"`   // Cores per socket
+	Sockets     int            `json:"sockets,omitempty"` // CPU sockets
+	CpuType     string         `json:"cpu,omitempty"`     // e.g. host or x86-64-v2-AES
+	Memory      int            `json:"memory,omitempty"`  // RAM in MB
+	Balloon     int            `json:"balloon,omitempty"` // Minimum RAM in MB for ballooning
+	Disks       []QemuDisk     `json:"disks,omitempty"`
+	Networks    []QemuNetwork  `json:"networks,omitempty"` // net0..netN, replacing the template's
+	Bridge      string         `json:"bridge,omitempty"`   // Default bridge for Networks
+	CloudInit   *QemuCloudInit `json:"cloud_init,omitempty"`
+	Agent       string         `json:"agent,omitempty"`  // 1 to enable the QEMU guest agent
+	OnBoot      string         `json:"onboot,omitempty"` // 1 to start with the node
+	Start       string         `json:"start,omitempty"`  // 1 to start once configured
+}
+
+// QemuDisk either grows an existing disk of the template, or adds a new one when Storage is set.
+type QemuDisk struct {
+	Name    string   `json:"name"`              // Bus and index, e.g. scsi0 or virtio1
+	Size    DiskSize `json:"size"`              // Size such as 32G; a new disk takes a number of GB
+	Storage string   `json:"storage,omitempty"` // Storage for a new disk
+	Options string   `json:"options,omitempty"` // Extra disk options for a new disk, e.g. discard=on,ssd=1
+}
+
+// QemuNetwork is one VM network interface, sent as netN.
+type QemuNetwork struct {
+	Model    string  `json:"model,omitempty"`  // Defaults to virtio
+	Bridge   string  `json:"bridge,omitempty"` // Defaults to the VM's Bridge
+	Macaddr  string  `json:"macaddr,omitempty"`
+	Tag      int     `json:"tag,omitempty"` // VLAN tag
+	Mtu      int     `json:"mtu,omitempty"`
+	Rate     float64 `json:"rate,omitempty"` // Rate limit in MB/s
+	Firewall bool    `json:"firewall,omitempty"`
+}
+
+// QemuCloudInit configures the template's cloud-init drive.
+type QemuCloudInit struct {
+	User          string         `json:"user,omitempty"`
+	Password      string         `json:"password,omitempty"`
+	SshPublicKeys []string       `json:"ssh_public_keys,omitempty"`
+	IpConfigs     []QemuIpConfig `json:"ipconfigs,omitempty"` // ipconfigN for netN
+	Nameserver    string         `json:"nameserver,omitempty"`
+	Searchdomain  string         `json:"searchdomain,omitempty"`
+	Drive         string         `json:"drive,omitempty"` // Storage to add a cloud-init drive on, for templates without one
+	// Custom snippets replace the generated cloud-init files. They are volume IDs on a storage
+	// with the snippets content type, e.g. local:snippets/user-data.yaml.
+	UserData    string `json:"user_data,omitempty"`
+	NetworkData string `json:"network_data,omitempty"`
+	MetaData    string `json:"meta_data,omitempty"`
+	VendorData  string `json:"vendor_data,omitempty"`
+}
+
+// QemuIpConfig is the cloud-init address of one interface, sent as ipconfigN.
+type QemuIpConfig struct {
+	Ip       string `json:"ip,omitempty"` // CIDR or dhcp
+	Gateway  string `json:"gw,omitempty"`
+	Ip6      string `json:"ip6,omitempty"` // CIDR, dhcp or auto
+	Gateway6 string `json:"gw6,omitempty"`
+}
+
+// String formats the interface as a Proxmox property string, e.g. model=virtio,bridge=vmbr0,tag=20.
+func (n QemuNetwork) String() string {
+	opts := []string{"model=" + n.Model, "bridge=" + n.Bridge}
+	if n.Macaddr != "" {
+		opts = append(opts, "macaddr="+n.Macaddr)
+	}
+	if n.Firewall {
+		opts = append(opts, "firewall=1")
+	}
+	if n.Mtu != 0 {
+		opts = append(opts, fmt.Sprintf("mtu=%d", n.Mtu))
+	}
+	if n.Rate != 0 {
+		opts = append(opts, "rate="+strconv.FormatFloat(n.Rate, 'f', -1, 64))
+	}
+	if n.Tag != 0 {
+		opts = append(opts, fmt.Sprintf("tag=%d", n.Tag))
+	}
+	return strings.Join(opts, ",")
+}
+
+// String formats the address as a Proxmox property string, e.g. ip=10.0.0.5/24,gw=10.0.0.1.
+func (ip QemuIpConfig) String() string {
+	var opts []string
+	if ip.Ip != "" {
+		opts = append(opts, "ip="+ip.Ip)
+	}
+	if ip.Gateway != "" {
+		opts = append(opts, "gw="+ip.Gateway)
+	}
+	if ip.Ip6 != "" {
+		opts = append(opts, "ip6="+ip.Ip6)
+	}
+	if ip.Gateway6 != "" {
+		opts = append(opts, "gw6="+ip.Gateway6)
+	}
+	return strings.Join(opts, ",")
+}
+
+// New reports whether the disk is added rather than resized.
+func (d QemuDisk) New() bool {
+	return d.Storage != ""
+}
+
+// CloneParams returns the parameters for CloneVm. sourceNode is the node the template is on; the
+// clone is moved to vm.Node when that differs.
+func (vm *QemuVm) CloneParams(sourceNode string) map[string]string {
+	params := map[string]string{"newid": fmt.Sprint(vm.VmId)}
+	if vm.Name != "" {
+		params["name"] = vm.Name
+	}
+	if vm.Node != "" && vm.Node != sourceNode {
+		params["target"] = vm.Node
+	}
+	if vm.FullClone {
+		params["full"] = "1"
+		if vm.Storage != "" {
+			params["storage"] = vm.Storage
+		}
+	}
+	if vm.Pool != "" {
+		params["pool"] = vm.Pool
+	}
+	if vm.Description != "" {
+		params["description"] = vm.Description
+	}
+	return params
+}
+
+// ConfigParams returns the settings applied to the clone with UpdateVmConfig. Disks that already
+// exist are resized separately, see Resizes.
+func (vm *QemuVm) ConfigParams() map[string]string {
+	params := make(map[string]string)
+
+	if vm.Tags != "" {
+		params["tags"] = vm.Tags
+	}
+	if vm.Cores != 0 {
+		params["cores"] = fmt.Sprint(vm.Cores)
+	}
+	if vm.Sockets != 0 {
+		params["sockets"] = fmt.Sprint(vm.Sockets)
+	}
+	if vm.CpuType != "" {
+		params["cpu"] = vm.CpuType
+	}
+	if vm.Memory != 0 {
+		params["memory"] = fmt.Sprint(vm.Memory)
+	}
+	if vm.Balloon != 0 {
+		params["balloon"] = fmt.Sprint(vm.Balloon)
+	}
+	for _, d := range vm.Disks {
+		if !d.New() {
+			continue
+		}
+		disk := d.Storage + ":" + d.Size.GB()
+		if d.Options != "" {
+			disk += "," + d.Options
+		}
+		params[d.Name] = disk
+	}
+	for i, n := range vm.networks() {
+		params[fmt.Sprintf("net%d", i)] = n.String()
+	}
+	if vm.Agent != "" {
+		params["agent"] = vm.Agent
+	}
+	if vm.OnBoot != "" {
+		params["onboot"] = vm.OnBoot
+	}
+
+	ci := vm.CloudInit
+	if ci == nil {
+		return params
+	}
+	if ci.Drive != "" {
+		params["ide2"] = ci.Drive + ":cloudinit"
+	}
+	if ci.User != "" {
+		params["ciuser"] = ci.User
+	}
+	if ci.Password != "" {
+		params["cipassword"] = ci.Password
+	}
+	if len(ci.SshPublicKeys) > 0 {
+		// Proxmox wants the keys URL encoded inside the form value, with %20 for spaces.
+		keys := url.QueryEscape(strings.Join(ci.SshPublicKeys, "\n"))
+		params["sshkeys"] = strings.ReplaceAll(keys, "+", "%20")
+	}
+	for i, ip := range ci.IpConfigs {
+		params[fmt.Sprintf("ipconfig%d", i)] = ip.String()
+	}
+	if ci.Nameserver != "" {
+		params["nameserver"] = ci.Nameserver
+	}
+	if ci.Searchdomain != "" {
+		params["searchdomain"] = ci.Searchdomain
+	}
+	var custom []string
+	for _, snippet := range []struct{ kind, volume string }{
+		{"user", ci.UserData}, {"network", ci.NetworkData}, {"meta", ci.MetaData}, {"vendor", ci.VendorData},
+	} {
+		if snippet.volume != "" {
+			custom = append(custom, snippet.kind+"="+snippet.volume)
+		}
+	}
+	if len(custom) > 0 {
+		params["cicustom"] = strings.Join(custom, ",")
+	}
+	return params
+}
+
+// Resizes returns the existing disks to grow, keyed by disk name.
+func (vm *QemuVm) Resizes() map[string]string {
+	resizes := make(map[string]string)
+	for _, d := range vm.Disks {
+		if !d.New() {
+			resizes[d.Name] = string(d.Size)
+		}
+	}
+	return resizes
+}
+
+// networks returns the VM's interfaces with the defaults filled in.
+func (vm *QemuVm) networks() []QemuNetwork {
+	out := make([]QemuNetwork, len(vm.Networks))
+	for i, n := range vm.Networks {
+		if n.Model == "" {
+			n.Model = "virtio"
+		}
+		if n.Bridge == "" {
+			n.Bridge = vm.Bridge
+		}
+		out[i] = n
+	}
+	return out
+}
+
+var (
+	qemuDiskNameRegex   = regexp.MustCompile(`^(scsi|virtio|sata|ide)\d+$`)
+	qemuResizeSizeRegex = regexp.MustCompile(`^\+?\d+(\.\d+)?[KMGT]?$`)
+	qemuNetworkModels   = []string{"virtio", "e1000", "e1000e", "rtl8139", "vmxnet3"}
+)
+
+// Validate checks the VM for missing required fields and combinations Proxmox would reject,
+// returning every problem found at once.
+func (vm *QemuVm) Validate() error {
+	var problems []string
+	fail := func(format string, a ...any) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	if vm.Template == "" {
+		fail("template is required")
+	}
+	if vm.VmId != 0 && (vm.VmId < 100 || vm.VmId > maxVmId) {
+		fail("vmid %d is out of range, must be between 100 and %d", vm.VmId, maxVmId)
+	}
+	if vm.Name != "" && (len(vm.Name) > 253 || !lxcHostnameRegex.MatchString(vm.Name)) {
+		fail("name %q is not a valid DNS name", vm.Name)
+	}
+	if vm.Storage != "" && !vm.FullClone {
+		fail("storage is only used for full clones, set full as well")
+	}
+	if vm.Cores < 0 || vm.Sockets < 0 || vm.Memory < 0 || vm.Balloon < 0 {
+		fail("cores, sockets, memory and balloon cannot be negative")
+	}
+	if vm.Balloon != 0 && vm.Memory != 0 && vm.Balloon > vm.Memory {
+		fail("balloon %d MB is more than memory %d MB", vm.Balloon, vm.Memory)
+	}
+
+	disks := make(map[string]bool)
+	for i, d := range vm.Disks {
+		switch {
+		case !qemuDiskNameRegex.MatchString(d.Name):
+			fail("disk %d: invalid name %q, expected e.g. scsi0 or virtio1", i, d.Name)
+		case disks[d.Name]:
+			fail("disk %d: %s is listed more than once", i, d.Name)
+		}
+		disks[d.Name] = true
+		switch {
+		case d.New() && !isLxcDiskSize(d.Size):
+			fail("disk %s: invalid size %q, a new disk takes a number of GB such as 32 or 32G", d.Name, d.Size)
+		case !d.New() && !qemuResizeSizeRegex.MatchString(string(d.Size)):
+			fail("disk %s: invalid size %q, expected e.g. 32G or +10G", d.Name, d.Size)
+		case !d.New() && d.Options != "":
+			fail("disk %s: options only apply to new disks with a storage", d.Name)
+		}
+	}
+
+	if len(vm.Networks) > maxVmNetworks {
+		fail("at most %d network interfaces are supported", maxVmNetworks)
+	}
+	for i, n := range vm.networks() {
+		if n.Bridge == "" {
+			fail("net%d: bridge is required", i)
+		}
+		if !slices.Contains(qemuNetworkModels, n.Model) {
+			fail("net%d: unsupported model %q", i, n.Model)
+		}
+		if n.Macaddr != "" {
+			if _, err := net.ParseMAC(n.Macaddr); err != nil {
+				fail("net%d: invalid macaddr %q", i, n.Macaddr)
+			}
+		}
+		if n.Tag < 0 || n.Tag > 4094 {
+			fail("net%d: VLAN tag %d is out of range 1-4094", i, n.Tag)
+		}
+		if n.Mtu != 0 && (n.Mtu < 576 || n.Mtu > 65520) {
+			fail("net%d: mtu %d is out of range 576-65520", i, n.Mtu)
+		}
+	}
+
+	if ci := vm.CloudInit; ci != nil {
+		if len(ci.IpConfigs) > maxVmNetworks {
+			fail("at most %d ipconfigs are supported", maxVmNetworks)
+		}
+		for i, ip := range ci.IpConfigs {
+			if ip.Ip == "manual" || ip.Ip6 == "manual" {
+				fail("ipconfig%d: cloud-init does not support manual addresses", i)
+				continue
+			}
+			if err := validateLxcIp(ip.Ip, ip.Gateway, false); err != nil {
+				fail("ipconfig%d: %v", i, err)
+			}
+			if err := validateLxcIp(ip.Ip6, ip.Gateway6, true); err != nil {
+				fail("ipconfig%d: %v", i, err)
+			}
+		}
+		for _, ns := range strings.Fields(strings.ReplaceAll(ci.Nameserver, ",", " ")) {
+			if net.ParseIP(ns) == nil {
+				fail("nameserver %q is not an IP address", ns)
+			}
+		}
+		for _, snippet := range []struct{ key, volume string }{
+			{"user_data", ci.UserData}, {"network_data", ci.NetworkData}, {"meta_data", ci.MetaData}, {"vendor_data", ci.VendorData},
+		} {
+			if snippet.volume != "" && !strings.Contains(snippet.volume, ":") {
+				fail("%s %q must be a volume ID such as local:snippets/%s.yaml", snippet.key, snippet.volume, snippet.key)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid VM %s: %s", vm.Name, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package proxmox
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ApiError is a non-2xx response from the Proxmox API.
+type ApiError struct {
+	Message string            `json:"message"` // Human readable message for clients
+	Code    int               `json:"-"`       // HTTP Status code. We use `-` to skip json marshaling.
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Errors  map[string]string `json:"errors,omitempty"` // Per parameter validation errors
+}
+
+func ApiErrorWrapper(code int, method, path, message string, errors map[string]string) error {
+	return ApiError{
+		Message: message,
+		Code:    code,
+		Method:  method,
+		Path:    path,
+		Errors:  errors,
+	}
+}
+
+func (err ApiError) Error() string {
+	msg := fmt.Sprintf("Proxmox API error: %s %s: %d %s", err.Method, err.Path, err.Code, err.Message)
+	if len(err.Errors) > 0 {
+		params := make([]string, 0, len(err.Errors))
+		for param, e := range err.Errors {
+			params = append(params, fmt.Sprintf("%s: %s", param, strings.TrimSpace(e)))
+		}
+		sort.Strings(params)
+		msg += " (" + strings.Join(params, "; ") + ")"
+	}
+	return msg
+}
+
+// TaskError is a Proxmox task that finished with an exit status other than OK.
+type TaskError struct {
+	Message string `json:"message"` // Human readable message for clients
+	Code    int    `json:"-"`       // HTTP Status code. We use `-` to skip json marshaling.
+	Upid    string `json:"upid"`
+	Status  string `json:"exitStatus"`
+}
+
+func TaskErrorWrapper(upid, exitStatus string) error {
+	return TaskError{
+		Message: "Proxmox task failed",
+		Code:    500,
+		Upid:    upid,
+		Status:  exitStatus,
+	}
+}
+
+func (err TaskError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", err.Message, err.Status, err.Upid)
+}
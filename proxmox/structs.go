@@ -6,42 +6,45 @@ import (
 	"os"
 )
 
-// Auth stores the Proxmox API token-based credentials.
+// Auth stores the Proxmox API token-based credentials and how the cluster's certificate is verified.
 type Auth struct {
 	Host     string // e.g. "https://proxmox.example.com:8006"
 	ApiToken string // Format: "USER@REALM!TOKENID=SECRET"
+	TLS      TLSOptions
 }
 
 type LxcContainer struct {
-	Node          string   `json:"node,omitempty"`       // Used in URL, not payload
-	VmId          int      `json:"vmid,omitempty"`       // Required
-	Hostname      string   `json:"hostname,omitempty"`   // Required
-	Password      string   `json:"password,omitempty"`   // Required if not using SSH key
-	OsTemplate    string   `json:"ostemplate,omitempty"` // Required (e.g., "local:vztmpl/ubuntu-22.04-standard_22.04-1_amd64.tar.zst")
-	Storage       string   `json:"storage,omitempty"`    // Required (storage ID for rootfs)
-	RootFsSize    string   `json:"rootfs,omitempty"`     // Required (e.g., "8G")
-	Memory        int      `json:"memory,omitempty"`     // RAM in MB
-	Swap          int      `json:"swap,omitempty"`       // Swap in MB
-	Cores         int      `json:"cores,omitempty"`      // CPU cores
-	CpuLimit      int      `json:"cpulimit,omitempty"`   // Limit in % of total
-	CpuUnits      int      `json:"cpuunits,omitempty"`   // Relative CPU weight
-	Net0          string   `json:"net0,omitempty"`       // Network config string
-	Bridge        string   `json:"bridge,omitempty"`     // Optional, if setting bridge separately
-	Nameserver    string   `json:"nameserver,omitempty"` // DNS
-	Searchdomain  string   `json:"searchdomain,omitempty"`
-	Pool          string   `json:"pool,omitempty"` // Optional pool
-	Description   string   `json:"description,omitempty"`
-	Unprivileged  string   `json:"unprivileged,omitempty"` // 1 or 0
-	Start         string   `json:"start,omitempty"`        // 1 to auto-start
-	BwLimit       int      `json:"bwlimit,omitempty"`
-	Arch          string   `json:"arch,omitempty"`            // e.g., "amd64"
-	Cmode         string   `json:"cmode,omitempty"`           // e.g., "tty"
-	Console       string   `json:"console,omitempty"`         // 0 or 1
-	Debug         int      `json:"debug,omitempty"`           // 0 or 1
-	Features      string   `json:"features,omitempty"`        // Comma-separated list
-	Startup       string   `json:"startup,omitempty"`         // Startup order string
-	Tags          string   `json:"tags,omitempty"`            // Comma-separated tags
-	SshPublicKeys []string `json:"ssh_public_keys,omitempty"` // SSH keys string
+	Node          string          `json:"node,omitempty"`        // Used in URL, not payload
+	VmId          int             `json:"vmid,omitempty"`        // Required
+	Hostname      string          `json:"hostname,omitempty"`    // Required
+	Password      string          `json:"password,omitempty"`    // Required if not using SSH key
+	OsTemplate    string          `json:"ostemplate,omitempty"`  // Required (e.g., "local:vztmpl/ubuntu-22.04-standard_22.04-1_amd64.tar.zst")
+	Storage       string          `json:"storage,omitempty"`     // Required (storage ID for rootfs)
+	RootFsSize    string          `json:"rootfs,omitempty"`      // Required (e.g., "8G")
+	Memory        int             `json:"memory,omitempty"`      // RAM in MB
+	Swap          int             `json:"swap,omitempty"`        // Swap in MB
+	Cores         int             `json:"cores,omitempty"`       // CPU cores
+	CpuLimit      int             `json:"cpulimit,omitempty"`    // Limit in % of total
+	CpuUnits      int             `json:"cpuunits,omitempty"`    // Relative CPU weight
+	Net0          string          `json:"net0,omitempty"`        // Network config string, or use Networks
+	Networks      []LxcNetwork    `json:"networks,omitempty"`    // Structured net0..netN
+	MountPoints   []LxcMountPoint `json:"mountpoints,omitempty"` // Extra volumes mp0..mpN
+	Bridge        string          `json:"bridge,omitempty"`      // Default bridge for Networks
+	Nameserver    string          `json:"nameserver,omitempty"`  // DNS
+	Searchdomain  string          `json:"searchdomain,omitempty"`
+	Pool          string          `json:"pool,omitempty"` // Optional pool
+	Description   string          `json:"description,omitempty"`
+	Unprivileged  string          `json:"unprivileged,omitempty"` // 1 or 0
+	Start         string          `json:"start,omitempty"`        // 1 to auto-start
+	BwLimit       int             `json:"bwlimit,omitempty"`
+	Arch          string          `json:"arch,omitempty"`            // e.g., "amd64"
+	Cmode         string          `json:"cmode,omitempty"`           // e.g., "tty"
+	Console       string          `json:"console,omitempty"`         // 0 or 1
+	Debug         int             `json:"debug,omitempty"`           // 0 or 1
+	Features      string          `json:"features,omitempty"`        // Comma-separated list
+	Startup       string          `json:"startup,omitempty"`         // Startup order string
+	Tags          string          `json:"tags,omitempty"`            // Comma-separated tags
+	SshPublicKeys []string        `json:"ssh_public_keys,omitempty"` // SSH keys string
 }
 
 func (lxc *LxcContainer) ToFormParams() map[string]string {
@@ -91,6 +94,39 @@ func (lxc *LxcContainer) ToFormParams() map[string]string {
 	if lxc.Net0 != "" {
 		params["net0"] = lxc.Net0
 	}
+	for i, n := range lxc.networks() {
+		params[fmt.Sprintf("net%d", i)] = n.String()
+	}
+	for i, m := range lxc.MountPoints {
+		params[fmt.Sprintf("mp%d", i)] = m.String()
+	}
+	if lxc.Nameserver != "" {
+		params["nameserver"] = lxc.Nameserver
+	}
+	if lxc.Searchdomain != "" {
+		params["searchdomain"] = lxc.Searchdomain
+	}
+	if lxc.Pool != "" {
+		params["pool"] = lxc.Pool
+	}
+	if lxc.Description != "" {
+		params["description"] = lxc.Description
+	}
+	if lxc.BwLimit != 0 {
+		params["bwlimit"] = fmt.Sprintf("%d", lxc.BwLimit)
+	}
+	if lxc.Debug != 0 {
+		params["debug"] = fmt.Sprintf("%d", lxc.Debug)
+	}
+	if lxc.Features != "" {
+		params["features"] = lxc.Features
+	}
+	if lxc.Startup != "" {
+		params["startup"] = lxc.Startup
+	}
+	if lxc.Tags != "" {
+		params["tags"] = lxc.Tags
+	}
 	if lxc.Arch != "" {
 		params["arch"] = lxc.Arch
 	}
@@ -0,0 +1,107 @@
+package proxmox
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TaskStatus is the state of a Proxmox task such as vzcreate or vzstart.
+type TaskStatus struct {
+	Upid       string `json:"upid"`
+	Node       string `json:"node"`
+	Type       string `json:"type"`
+	Id         string `json:"id"`
+	User       string `json:"user"`
+	Status     string `json:"status"`     // running or stopped
+	ExitStatus string `json:"exitstatus"` // OK once stopped successfully
+	StartTime  int64  `json:"starttime"`
+}
+
+// Running reports whether the task has not finished yet.
+func (t *TaskStatus) Running() bool {
+	return t.Status == "running"
+}
+
+// TaskLogLine is one line of a task's log.
+type TaskLogLine struct {
+	N int    `json:"n"`
+	T string `json:"t"`
+}
+
+// NodeFromUpid returns the node a task runs on from its UPID, UPID:node:pid:pstart:starttime:...
+func NodeFromUpid(upid string) string {
+	parts := strings.Split(upid, ":")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+func (c *Client) TaskStatus(ctx context.Context, node, upid string) (*TaskStatus, error) {
+	status := &TaskStatus{}
+	if err := c.Get(ctx, nodePath(node, "/tasks/%s/status", url.PathEscape(upid)), nil, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// TaskLog returns the log lines of a task starting at line start.
+func (c *Client) TaskLog(ctx context.Context, node, upid string, start int) ([]TaskLogLine, error) {
+	var lines []TaskLogLine
+	query := url.Values{"start": {fmt.Sprint(start)}, "limit": {"500"}}
+	if err := c.Get(ctx, nodePath(node, "/tasks/%s/log", url.PathEscape(upid)), query, &lines); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// WaitForTask polls the task until it stops, writing new log lines to c.TaskOutput as they appear.
+// It returns a TaskError when the task's exit status is not OK. An empty node is taken from the UPID.
+func (c *Client) WaitForTask(ctx context.Context, node, upid string) (*TaskStatus, error) {
+	if node == "" {
+		node = NodeFromUpid(upid)
+	}
+
+	logged := 0
+	streamLog := func() {
+		if c.TaskOutput == nil {
+			return
+		}
+		lines, err := c.TaskLog(ctx, node, upid, logged)
+		if err != nil {
+			return
+		}
+		for _, line := range lines {
+			// Proxmox returns a single "no content" line for tasks without output yet.
+			if line.N > logged && line.T != "no content" {
+				fmt.Fprintln(c.TaskOutput, line.T)
+				logged = line.N
+			}
+		}
+	}
+
+	ticker := time.NewTicker(c.PollInterval)
+	defer ticker.Stop()
+	for {
+		status, err := c.TaskStatus(ctx, node, upid)
+		if err != nil {
+			return nil, err
+		}
+		streamLog()
+		if !status.Running() {
+			if status.ExitStatus != "OK" {
+				return status, TaskErrorWrapper(upid, status.ExitStatus)
+			}
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package proxmox
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// TLSOptions controls how the Proxmox API certificate is verified. Proxmox nodes ship with
+// self-signed certificates, so a cluster usually needs one of these set.
+type TLSOptions struct {
+	CABundle           string `json:"caBundle,omitempty" yaml:"ca_bundle,omitempty"`      // PEM file with the CA(s) to trust in addition to the system pool
+	Fingerprint        string `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"` // SHA-256 of the server certificate, hex with or without colons
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+}
+
+// TLSConfig builds the tls.Config for the options. With a pinned fingerprint the certificate chain
+// is only verified when a CA bundle is also given; the fingerprint must match either way.
+func (o TLSOptions) TLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if o.CABundle != "" {
+		pem, err := os.ReadFile(o.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("error reading Proxmox CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in Proxmox CA bundle %s", o.CABundle)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if o.Fingerprint != "" {
+		pin, err := parseFingerprint(o.Fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		cfg.InsecureSkipVerify = o.CABundle == ""
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("Proxmox server sent no certificate")
+			}
+			sum := sha256.Sum256(rawCerts[0])
+			if hex.EncodeToString(sum[:]) != pin {
+				return fmt.Errorf("Proxmox certificate fingerprint %s does not match the pinned fingerprint", formatFingerprint(sum[:]))
+			}
+			return nil
+		}
+		return cfg, nil
+	}
+
+	if o.InsecureSkipVerify {
+		slog.Warn("Proxmox TLS certificate verification is disabled by insecure_skip_verify")
+		cfg.InsecureSkipVerify = true
+	}
+	return cfg, nil
+}
+
+// parseFingerprint normalizes AA:BB:... or aabb... to lowercase hex.
+func parseFingerprint(fp string) (string, error) {
+	fp = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fp), ":", ""))
+	if b, err := hex.DecodeString(fp); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid Proxmox certificate fingerprint, expected a SHA-256 hex digest")
+	}
+	return fp, nil
+}
+
+// formatFingerprint formats a digest the way Proxmox shows it, AA:BB:CC:...
+func formatFingerprint(sum []byte) string {
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
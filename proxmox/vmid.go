@@ -0,0 +1,129 @@
+package proxmox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxVmId is the highest VMID Proxmox accepts.
+const maxVmId = 999999999
+
+// VmIdRange is an inclusive range of VMIDs, e.g. 200-299 for dev guests. The zero value means any
+// free VMID from the cluster's next free one up.
+type VmIdRange struct {
+	Min int
+	Max int
+}
+
+// ParseVmIdRange parses min-max, e.g. 200-299.
+func ParseVmIdRange(s string) (VmIdRange, error) {
+	lo, hi, ok := strings.Cut(strings.TrimSpace(s), "-")
+	min, errMin := strconv.Atoi(strings.TrimSpace(lo))
+	max, errMax := strconv.Atoi(strings.TrimSpace(hi))
+	if !ok || errMin != nil || errMax != nil || min < 100 || max < min || max > maxVmId {
+		return VmIdRange{}, fmt.Errorf("invalid VMID range %q, expected min-max with 100 <= min <= max", s)
+	}
+	return VmIdRange{Min: min, Max: max}, nil
+}
+
+func (r VmIdRange) String() string {
+	if r.Min == 0 {
+		return "any"
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// NextVmId returns the cluster's next free VMID.
+func (c *Client) NextVmId(ctx context.Context) (int, error) {
+	var id json.Number
+	if err := c.Get(ctx, "/cluster/nextid", nil, &id); err != nil {
+		return 0, err
+	}
+	n, err := id.Int64()
+	return int(n), err
+}
+
+// vmIdFree asks the cluster whether id is free; Proxmox answers 400 when it is taken.
+func (c *Client) vmIdFree(ctx context.Context, id int) (bool, error) {
+	err := c.Get(ctx, "/cluster/nextid", url.Values{"vmid": {strconv.Itoa(id)}}, nil)
+	var apiErr ApiError
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// VmIdAllocator hands out free VMIDs and remembers the ones it returned or reserved, so guests
+// created in one batch never get the same VMID even before they exist. It is safe for concurrent
+// use.
+type VmIdAllocator struct {
+	client   *Client
+	mu       sync.Mutex
+	used     map[int]bool // guests in the cluster, loaded on first use
+	reserved map[int]bool
+}
+
+func (c *Client) NewVmIdAllocator() *VmIdAllocator {
+	return &VmIdAllocator{client: c, reserved: make(map[int]bool)}
+}
+
+// Reserve claims an explicitly chosen VMID, failing if the allocator already handed it out or it
+// was reserved before.
+func (a *VmIdAllocator) Reserve(id int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.reserved[id] {
+		return fmt.Errorf("VMID %d is already allocated", id)
+	}
+	a.reserved[id] = true
+	return nil
+}
+
+// Next returns the lowest free VMID in r that has not been handed out yet.
+func (a *VmIdAllocator) Next(ctx context.Context, r VmIdRange) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.used == nil {
+		guests, err := a.client.ClusterGuests(ctx)
+		if err != nil {
+			return 0, err
+		}
+		a.used = make(map[int]bool, len(guests))
+		for _, g := range guests {
+			a.used[g.VmId] = true
+		}
+	}
+
+	if r.Min == 0 {
+		next, err := a.client.NextVmId(ctx)
+		if err != nil {
+			return 0, err
+		}
+		r = VmIdRange{Min: next, Max: maxVmId}
+	}
+	for id := r.Min; id <= r.Max; id++ {
+		if a.used[id] || a.reserved[id] {
+			continue
+		}
+		// Double check with the cluster, which also knows about IDs locked by running tasks.
+		free, err := a.client.vmIdFree(ctx, id)
+		if err != nil {
+			return 0, err
+		}
+		if !free {
+			a.used[id] = true
+			continue
+		}
+		a.reserved[id] = true
+		return id, nil
+	}
+	return 0, fmt.Errorf("no free VMID in range %s", r)
+}
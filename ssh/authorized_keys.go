@@ -0,0 +1,306 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const authorizedKeysFile string = ".ssh/authorized_keys"
+
+// AuthorizedKey is one line of an authorized_keys file. Lines that are not keys (comments, blank
+// lines, unparsable entries) are kept verbatim in Raw with a nil Key so files round-trip unchanged.
+type AuthorizedKey struct {
+	Options     []string      `json:"options,omitempty" yaml:"options,omitempty"`
+	Key         ssh.PublicKey `json:"-" yaml:"-"`
+	Comment     string        `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Fingerprint string        `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	Raw         string        `json:"raw" yaml:"raw"`
+}
+
+// ParseAuthorizedKeyLine parses a single authorized_keys line.
+func ParseAuthorizedKeyLine(line string) AuthorizedKey {
+	trimmed := strings.TrimSpace(line)
+	entry := AuthorizedKey{Raw: line}
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return entry
+	}
+	key, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(trimmed))
+	if err != nil {
+		return entry
+	}
+	entry.Key = key
+	entry.Comment = comment
+	entry.Options = options
+	entry.Fingerprint = ssh.FingerprintSHA256(key)
+	entry.Raw = trimmed
+	return entry
+}
+
+// ParseAuthorizedKeys parses the contents of an authorized_keys file.
+func ParseAuthorizedKeys(data []byte) []AuthorizedKey {
+	text := strings.TrimRight(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+	entries := make([]AuthorizedKey, 0, len(lines))
+	for _, line := range lines {
+		entries = append(entries, ParseAuthorizedKeyLine(line))
+	}
+	return entries
+}
+
+// FormatAuthorizedKeys renders entries back into authorized_keys format.
+func FormatAuthorizedKeys(entries []AuthorizedKey) []byte {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		buf.WriteString(e.Raw)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// authorizedKeysOwner is where a user's authorized_keys lives and who must own it.
+type authorizedKeysOwner struct {
+	path     string
+	uid, gid int
+	chown    bool
+}
+
+// authorizedKeysLocation resolves the authorized_keys path for user. An empty user, or the user the
+// agent connected as, uses the home-relative path; any other user is looked up with getent and
+// the file is chowned to them after writing.
+func (r *RemoteAppDeploymentAgent) authorizedKeysLocation(ctx context.Context, user string) (authorizedKeysOwner, error) {
+	if user == "" || user == r.User {
+		return authorizedKeysOwner{path: authorizedKeysFile}, nil
+	}
+
+	result, err := r.RunCommandWithResult(ctx, "getent", []string{"passwd", ShellQuote(user)})
+	if err != nil {
+		return authorizedKeysOwner{}, fmt.Errorf("unable to look up user %s on %s: %w", user, r.Hostname, err)
+	}
+	// name:password:uid:gid:gecos:home:shell
+	fields := strings.Split(strings.TrimSpace(result.Stdout), ":")
+	if len(fields) < 7 {
+		return authorizedKeysOwner{}, fmt.Errorf("unexpected getent output for %s on %s: %q", user, r.Hostname, result.Stdout)
+	}
+	uid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return authorizedKeysOwner{}, fmt.Errorf("invalid uid for %s: %w", user, err)
+	}
+	gid, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return authorizedKeysOwner{}, fmt.Errorf("invalid gid for %s: %w", user, err)
+	}
+	return authorizedKeysOwner{path: path.Join(fields[5], authorizedKeysFile), uid: uid, gid: gid, chown: true}, nil
+}
+
+// ReadAuthorizedKeys reads user's ~/.ssh/authorized_keys (the connected user when user is empty).
+// A missing file yields no entries.
+func (r *RemoteAppDeploymentAgent) ReadAuthorizedKeys(ctx context.Context, user string) ([]AuthorizedKey, error) {
+	location, err := r.authorizedKeysLocation(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	sftpClient, err := r.GetSftpClient()
+	if err != nil {
+		return nil, err
+	}
+	defer sftpClient.Close()
+
+	f, err := sftpClient.Open(location.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, SftpErrorWrapper(501, err, "error opening authorized_keys")
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, SftpErrorWrapper(501, err, "error reading authorized_keys")
+	}
+	return ParseAuthorizedKeys(data), nil
+}
+
+// WriteAuthorizedKeys replaces user's ~/.ssh/authorized_keys, creating ~/.ssh with mode 0700 and
+// the file with mode 0600, both owned by user. The keys are written to a temporary file in ~/.ssh
+// that is renamed over the old file, so a failed write never leaves it empty or partial.
+func (r *RemoteAppDeploymentAgent) WriteAuthorizedKeys(ctx context.Context, user string, entries []AuthorizedKey) error {
+	location, err := r.authorizedKeysLocation(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	sftpClient, err := r.GetSftpClient()
+	if err != nil {
+		return err
+	}
+	defer sftpClient.Close()
+
+	dir := path.Dir(location.path)
+	if err := sftpClient.MkdirAll(dir); err != nil {
+		return SftpFileCreationErrorWrapper(504, err, "error creating ~/.ssh")
+	}
+	if err := sftpClient.Chmod(dir, 0o700); err != nil {
+		return SftpErrorWrapper(501, err, "error setting ~/.ssh mode")
+	}
+	if location.chown {
+		if err := sftpClient.Chown(dir, location.uid, location.gid); err != nil {
+			return SftpErrorWrapper(501, err, "error setting ~/.ssh owner")
+		}
+	}
+
+	tmp := fmt.Sprintf("%s.%d.tmp", location.path, time.Now().UnixNano())
+	if err := writeAuthorizedKeysFile(sftpClient, tmp, location, FormatAuthorizedKeys(entries)); err != nil {
+		sftpClient.Remove(tmp)
+		return err
+	}
+	if err := sftpClient.PosixRename(tmp, location.path); err != nil {
+		sftpClient.Remove(tmp)
+		return SftpErrorWrapper(501, err, "error replacing authorized_keys")
+	}
+	return nil
+}
+
+// writeAuthorizedKeysFile writes data to name with the mode and owner authorized_keys needs.
+func writeAuthorizedKeysFile(sftpClient *sftp.Client, name string, location authorizedKeysOwner, data []byte) error {
+	f, err := sftpClient.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return SftpFileCreationErrorWrapper(504, err, "error creating temporary authorized_keys")
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return SftpFileCreationErrorWrapper(504, err, "error writing authorized_keys")
+	}
+	if err := f.Close(); err != nil {
+		return SftpFileCreationErrorWrapper(504, err, "error writing authorized_keys")
+	}
+	if err := sftpClient.Chmod(name, 0o600); err != nil {
+		return SftpErrorWrapper(501, err, "error setting authorized_keys mode")
+	}
+	if location.chown {
+		if err := sftpClient.Chown(name, location.uid, location.gid); err != nil {
+			return SftpErrorWrapper(501, err, "error setting authorized_keys owner")
+		}
+	}
+	return nil
+}
+
+// AddAuthorizedKey appends line to user's authorized_keys unless a key with the same fingerprint
+// is already present. It reports whether the file was changed.
+func (r *RemoteAppDeploymentAgent) AddAuthorizedKey(ctx context.Context, user, line string) (bool, error) {
+	entry := ParseAuthorizedKeyLine(line)
+	if entry.Key == nil {
+		return false, fmt.Errorf("invalid authorized key %q", line)
+	}
+
+	entries, err := r.ReadAuthorizedKeys(ctx, user)
+	if err != nil {
+		return false, err
+	}
+	for _, e := range entries {
+		if e.Fingerprint == entry.Fingerprint {
+			slog.Info("authorized key already present", slog.String("host", r.Hostname), slog.String("fingerprint", entry.Fingerprint))
+			return false, nil
+		}
+	}
+	return true, r.WriteAuthorizedKeys(ctx, user, append(entries, entry))
+}
+
+// DedupeAuthorizedKeys drops later entries whose fingerprint was already seen. Non-key lines are kept.
+func DedupeAuthorizedKeys(entries []AuthorizedKey) []AuthorizedKey {
+	seen := make(map[string]bool)
+	out := make([]AuthorizedKey, 0, len(entries))
+	for _, e := range entries {
+		if e.Key != nil {
+			if seen[e.Fingerprint] {
+				continue
+			}
+			seen[e.Fingerprint] = true
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// RemoveAuthorizedKeys drops key entries whose fingerprint or comment matches any of match and
+// returns the remaining entries along with the removed ones.
+func RemoveAuthorizedKeys(entries []AuthorizedKey, match []string) (kept, removed []AuthorizedKey) {
+	for _, e := range entries {
+		if e.Key != nil && slices.ContainsFunc(match, func(m string) bool {
+			return m == e.Fingerprint || (e.Comment != "" && m == e.Comment)
+		}) {
+			removed = append(removed, e)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return kept, removed
+}
+
+// DiffAuthorizedKeys compares the keys in current and desired by fingerprint.
+func DiffAuthorizedKeys(current, desired []AuthorizedKey) (added, removed []AuthorizedKey) {
+	has := func(entries []AuthorizedKey, fp string) bool {
+		return slices.ContainsFunc(entries, func(e AuthorizedKey) bool { return e.Key != nil && e.Fingerprint == fp })
+	}
+	for _, e := range desired {
+		if e.Key != nil && !has(current, e.Fingerprint) {
+			added = append(added, e)
+		}
+	}
+	for _, e := range current {
+		if e.Key != nil && !has(desired, e.Fingerprint) {
+			removed = append(removed, e)
+		}
+	}
+	return added, removed
+}
+
+// SyncAuthorizedKeys returns current rewritten to contain exactly the keys in desired. Comment and
+// blank lines in current are kept, keys that stay take the options and comment from desired, and
+// new keys are appended in desired order.
+func SyncAuthorizedKeys(current, desired []AuthorizedKey) []AuthorizedKey {
+	desired = DedupeAuthorizedKeys(desired)
+	wanted := make(map[string]AuthorizedKey)
+	for _, e := range desired {
+		if e.Key != nil {
+			wanted[e.Fingerprint] = e
+		}
+	}
+
+	out := make([]AuthorizedKey, 0, len(desired))
+	placed := make(map[string]bool)
+	for _, e := range current {
+		if e.Key == nil {
+			out = append(out, e)
+			continue
+		}
+		if w, ok := wanted[e.Fingerprint]; ok && !placed[e.Fingerprint] {
+			out = append(out, w)
+			placed[e.Fingerprint] = true
+		}
+	}
+	for _, e := range desired {
+		if e.Key != nil && !placed[e.Fingerprint] {
+			out = append(out, e)
+			placed[e.Fingerprint] = true
+		}
+	}
+	return out
+}
@@ -0,0 +1,128 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/babbage88/goph/v2"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// ReplaceHostKey trusts the key a host presents, replacing any key known_hosts has for its
+// address. It is only meant for hosts that were just created, such as a new container given the
+// address of a destroyed one, where a changed key is expected rather than a sign of an attack.
+func ReplaceHostKey(host string, remote net.Addr, key ssh.PublicKey) error {
+	hostFound, err := goph.CheckKnownHost(host, remote, key, "")
+	if hostFound && err == nil {
+		return nil
+	}
+	if hostFound {
+		removed, err := RemoveKnownHost(host, remote.String())
+		if err != nil {
+			return err
+		}
+		slog.Warn("replaced changed host key of new host in known_hosts", slog.String("host", host), slog.Int("removed", removed))
+	}
+	return goph.AddKnownHost(host, remote, key, "")
+}
+
+// RemoveKnownHost removes the lines of ~/.ssh/known_hosts that name any of addresses, given as
+// host or host:port, including hashed entries. It returns how many lines were removed.
+func RemoveKnownHost(addresses ...string) (int, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return 0, err
+	}
+	file := filepath.Join(home, ".ssh", "known_hosts")
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading known_hosts: %w", err)
+	}
+
+	hosts := make([]string, len(addresses))
+	for i, a := range addresses {
+		hosts[i] = knownhosts.Normalize(a)
+	}
+	var kept bytes.Buffer
+	removed := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if knownHostsLineMatches(line, hosts) {
+			removed++
+			continue
+		}
+		kept.WriteString(line)
+		kept.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("error reading known_hosts: %w", err)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, kept.Bytes(), info.Mode().Perm()); err != nil {
+		return 0, fmt.Errorf("error writing known_hosts: %w", err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return 0, fmt.Errorf("error writing known_hosts: %w", err)
+	}
+	return removed, nil
+}
+
+// knownHostsLineMatches reports whether a known_hosts line names one of hosts, which must be
+// normalized. Wildcard and negated patterns are never matched.
+func knownHostsLineMatches(line string, hosts []string) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+		return false
+	}
+	patterns := fields[0]
+	if strings.HasPrefix(patterns, "@") {
+		patterns = fields[1]
+	}
+	for _, pattern := range strings.Split(patterns, ",") {
+		if hashed, ok := strings.CutPrefix(pattern, "|1|"); ok {
+			salt64, hash64, _ := strings.Cut(hashed, "|")
+			salt, err1 := base64.StdEncoding.DecodeString(salt64)
+			hash, err2 := base64.StdEncoding.DecodeString(hash64)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			for _, h := range hosts {
+				mac := hmac.New(sha1.New, salt)
+				mac.Write([]byte(h))
+				if hmac.Equal(mac.Sum(nil), hash) {
+					return true
+				}
+			}
+			continue
+		}
+		if slices.Contains(hosts, pattern) {
+			return true
+		}
+	}
+	return false
+}
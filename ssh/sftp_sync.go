@@ -0,0 +1,213 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/sftp"
+)
+
+// CopyOptions controls recursive copies between the local and remote host.
+type CopyOptions struct {
+	PreserveMode  bool // copy permission bits and modification times
+	PreserveOwner bool // copy uid/gid; needs root on the receiving side
+}
+
+// DownloadGlob copies every remote path matching pattern into dst. Directories are copied
+// recursively. When more than one path matches, or dst ends in a separator or is an existing
+// directory, each match is written beneath dst using its base name. It returns the local paths
+// written.
+func (r *RemoteAppDeploymentAgent) DownloadGlob(ctx context.Context, pattern, dst string, opts CopyOptions) ([]string, error) {
+	sftpClient, err := r.GetSftpClient()
+	if err != nil {
+		return nil, err
+	}
+	defer sftpClient.Close()
+
+	matches, err := sftpClient.Glob(pattern)
+	if err != nil {
+		return nil, SftpErrorWrapper(501, err, "invalid remote glob pattern")
+	}
+	if len(matches) == 0 {
+		return nil, SftpErrorWrapper(404, fmt.Errorf("no remote files match %s", pattern), "no remote files matched")
+	}
+
+	intoDir := len(matches) > 1 || strings.HasSuffix(dst, string(os.PathSeparator))
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		intoDir = true
+	}
+
+	var written []string
+	for _, match := range matches {
+		target := dst
+		if intoDir {
+			target = filepath.Join(dst, path.Base(match))
+		}
+		files, err := r.downloadTree(ctx, sftpClient, match, target, opts)
+		written = append(written, files...)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (r *RemoteAppDeploymentAgent) downloadTree(ctx context.Context, sftpClient *sftp.Client, src, dst string, opts CopyOptions) ([]string, error) {
+	var written []string
+	walker := sftpClient.Walk(src)
+	for walker.Step() {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		if err := walker.Err(); err != nil {
+			return written, SftpErrorWrapper(501, err, "error walking remote path")
+		}
+
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), src), "/")
+		target := filepath.Join(dst, filepath.FromSlash(rel))
+		info := walker.Stat()
+
+		switch {
+		case info.IsDir():
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return written, err
+			}
+		case info.Mode().IsRegular():
+			if err := downloadFile(sftpClient, walker.Path(), target); err != nil {
+				return written, SftpErrorWrapper(501, err, "error downloading file over sftp")
+			}
+			written = append(written, target)
+		default:
+			slog.Warn("skipping non-regular remote file", slog.String("path", walker.Path()))
+			continue
+		}
+		applyLocalAttributes(target, info, opts)
+	}
+	return written, nil
+}
+
+func downloadFile(sftpClient *sftp.Client, src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	remote, err := sftpClient.Open(src)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+
+	local, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+
+	_, err = remote.WriteTo(local)
+	return err
+}
+
+func applyLocalAttributes(target string, info fs.FileInfo, opts CopyOptions) {
+	if opts.PreserveMode {
+		if err := os.Chmod(target, info.Mode().Perm()); err != nil {
+			slog.Warn("unable to preserve mode", slog.String("path", target), slog.String("error", err.Error()))
+		}
+		if err := os.Chtimes(target, info.ModTime(), info.ModTime()); err != nil {
+			slog.Warn("unable to preserve mtime", slog.String("path", target), slog.String("error", err.Error()))
+		}
+	}
+	if opts.PreserveOwner {
+		if stat, ok := info.Sys().(*sftp.FileStat); ok {
+			if err := os.Lchown(target, int(stat.UID), int(stat.GID)); err != nil {
+				slog.Warn("unable to preserve owner", slog.String("path", target), slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// UploadTree copies a local file or directory to dst on the remote host, recursing into
+// directories. If dst ends with "/" or is an existing remote directory, the source is placed
+// beneath it using its base name.
+func (r *RemoteAppDeploymentAgent) UploadTree(ctx context.Context, src, dst string, opts CopyOptions) ([]string, error) {
+	sftpClient, err := r.GetSftpClient()
+	if err != nil {
+		return nil, err
+	}
+	defer sftpClient.Close()
+
+	intoDir := strings.HasSuffix(dst, "/")
+	if info, err := sftpClient.Stat(dst); err == nil && info.IsDir() {
+		intoDir = true
+	}
+	if intoDir {
+		dst = path.Join(dst, filepath.Base(src))
+	}
+
+	var written []string
+	err = filepath.WalkDir(src, func(localPath string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, localPath)
+		if err != nil {
+			return err
+		}
+		target := path.Join(dst, filepath.ToSlash(rel))
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			if err := sftpClient.MkdirAll(target); err != nil {
+				return SftpFileCreationErrorWrapper(504, err, "error creating remote directory")
+			}
+		case info.Mode().IsRegular():
+			if err := r.uploadFile(ctx, sftpClient, localPath, target, r.uploadOptions(localPath)); err != nil {
+				return err
+			}
+			written = append(written, target)
+		default:
+			slog.Warn("skipping non-regular local file", slog.String("path", localPath))
+			return nil
+		}
+		return applyRemoteAttributes(sftpClient, target, info, opts)
+	})
+	return written, err
+}
+
+func applyRemoteAttributes(sftpClient *sftp.Client, target string, info fs.FileInfo, opts CopyOptions) error {
+	if opts.PreserveMode {
+		if err := sftpClient.Chmod(target, info.Mode().Perm()); err != nil {
+			return SftpErrorWrapper(501, err, "error preserving remote file mode")
+		}
+		if err := sftpClient.Chtimes(target, info.ModTime(), info.ModTime()); err != nil {
+			return SftpErrorWrapper(501, err, "error preserving remote file mtime")
+		}
+	}
+	if opts.PreserveOwner {
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		if err := sftpClient.Chown(target, int(stat.Uid), int(stat.Gid)); err != nil {
+			if errors.Is(err, os.ErrPermission) {
+				slog.Warn("unable to preserve owner on remote", slog.String("path", target))
+				return nil
+			}
+			return SftpErrorWrapper(501, err, "error preserving remote file owner")
+		}
+	}
+	return nil
+}
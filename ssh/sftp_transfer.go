@@ -0,0 +1,274 @@
+package ssh
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+const defaultTransferChunkSize int = 1 << 20 // 1 MiB
+
+// TransferProgress is a snapshot of an in-flight file transfer.
+type TransferProgress struct {
+	Path        string        `json:"path"`
+	Transferred int64         `json:"transferred"` // bytes on the remote side, including any resumed prefix
+	Total       int64         `json:"total"`
+	Rate        float64       `json:"rate"` // bytes per second for this session
+	ETA         time.Duration `json:"eta"`
+	Done        bool          `json:"done"`
+}
+
+type ProgressFunc func(p TransferProgress)
+
+// UploadOptions controls UploadFile.
+type UploadOptions struct {
+	ChunkSize int          // bytes per SFTP write, defaults to 1 MiB
+	Resume    bool         // continue a partial upload when the remote prefix matches the local file
+	Verify    bool         // compare SHA-256 of the local and remote file once the transfer finishes
+	Progress  ProgressFunc // optional progress callback
+}
+
+// UploadFile copies a single local file to dst over SFTP in chunks. With Resume set, an existing
+// remote file that is a byte-for-byte prefix of src (checked by size and SHA-256) is appended to
+// instead of re-sent, so an upload interrupted by a dropped connection picks up where it stopped.
+func (r *RemoteAppDeploymentAgent) UploadFile(ctx context.Context, src, dst string, opts UploadOptions) error {
+	sftpClient, err := r.GetSftpClient()
+	if err != nil {
+		return err
+	}
+	defer sftpClient.Close()
+	return r.uploadFile(ctx, sftpClient, src, dst, opts)
+}
+
+// uploadFile is UploadFile over an open SFTP client, so a tree of files can share one.
+func (r *RemoteAppDeploymentAgent) uploadFile(ctx context.Context, sftpClient *sftp.Client, src, dst string, opts UploadOptions) error {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaultTransferChunkSize
+	}
+
+	local, err := os.Open(src)
+	if err != nil {
+		return SftpErrorWrapper(501, err, "error opening local file for upload")
+	}
+	defer local.Close()
+
+	stat, err := local.Stat()
+	if err != nil {
+		return SftpErrorWrapper(501, err, "error reading local file info")
+	}
+	total := stat.Size()
+
+	var offset int64
+	if opts.Resume {
+		offset, err = r.resumeOffset(ctx, sftpClient, local, dst, total)
+		if err != nil {
+			return err
+		}
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	remote, err := sftpClient.OpenFile(dst, flags)
+	if err != nil {
+		return SftpFileCreationErrorWrapper(504, err, "error opening remote file for upload")
+	}
+	defer remote.Close()
+
+	if _, err := remote.Seek(offset, io.SeekStart); err != nil {
+		return SftpErrorWrapper(501, err, "error seeking remote file")
+	}
+	if _, err := local.Seek(offset, io.SeekStart); err != nil {
+		return SftpErrorWrapper(501, err, "error seeking local file")
+	}
+	if offset > 0 {
+		slog.Info("Resuming upload", slog.String("dst", dst), slog.Int64("offset", offset), slog.Int64("size", total))
+	}
+
+	err = copyWithProgress(ctx, remote, local, dst, offset, total, opts)
+	if err != nil {
+		return SftpErrorWrapper(501, err, "error preforming upload over sftp")
+	}
+
+	if opts.Verify {
+		if err := r.verifyUpload(ctx, sftpClient, local, dst, total); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyWithProgress(ctx context.Context, dst io.Writer, src io.Reader, path string, offset, total int64, opts UploadOptions) error {
+	buf := make([]byte, opts.ChunkSize)
+	start := time.Now()
+	transferred := offset
+	lastReport := time.Time{}
+
+	report := func(done bool) {
+		if opts.Progress == nil {
+			return
+		}
+		elapsed := time.Since(start).Seconds()
+		p := TransferProgress{Path: path, Transferred: transferred, Total: total, Done: done}
+		if elapsed > 0 {
+			p.Rate = float64(transferred-offset) / elapsed
+		}
+		if p.Rate > 0 {
+			p.ETA = time.Duration(float64(total-transferred) / p.Rate * float64(time.Second))
+		}
+		opts.Progress(p)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+			transferred += int64(n)
+			if time.Since(lastReport) >= 200*time.Millisecond {
+				report(false)
+				lastReport = time.Now()
+			}
+		}
+		if readErr == io.EOF {
+			report(true)
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// resumeOffset returns how many bytes of dst can be kept, or zero when the upload has to start over.
+func (r *RemoteAppDeploymentAgent) resumeOffset(ctx context.Context, sftpClient *sftp.Client, local *os.File, dst string, total int64) (int64, error) {
+	info, err := sftpClient.Stat(dst)
+	if err != nil || info.IsDir() {
+		return 0, nil
+	}
+	size := info.Size()
+	if size == 0 || size > total {
+		return 0, nil
+	}
+
+	localHash, err := sha256Prefix(local, size)
+	if err != nil {
+		return 0, SftpErrorWrapper(501, err, "error hashing local file")
+	}
+	remoteHash, err := r.remoteSha256(ctx, sftpClient, dst, size)
+	if err != nil {
+		slog.Warn("unable to hash partial remote file, restarting upload", slog.String("dst", dst), slog.String("error", err.Error()))
+		return 0, nil
+	}
+	if localHash != remoteHash {
+		slog.Info("Remote file differs from local prefix, restarting upload", slog.String("dst", dst))
+		return 0, nil
+	}
+	return size, nil
+}
+
+func (r *RemoteAppDeploymentAgent) verifyUpload(ctx context.Context, sftpClient *sftp.Client, local *os.File, dst string, total int64) error {
+	localHash, err := sha256Prefix(local, total)
+	if err != nil {
+		return SftpErrorWrapper(501, err, "error hashing local file")
+	}
+	remoteHash, err := r.remoteSha256(ctx, sftpClient, dst, total)
+	if err != nil {
+		return SftpErrorWrapper(501, err, "error hashing remote file")
+	}
+	if localHash != remoteHash {
+		err := fmt.Errorf("checksum mismatch for %s: local %s remote %s", dst, localHash, remoteHash)
+		return SftpErrorWrapper(501, err, "uploaded file failed checksum verification")
+	}
+	slog.Info("Verified upload checksum", slog.String("dst", dst), slog.String("sha256", localHash))
+	return nil
+}
+
+func sha256Prefix(f *os.File, n int64) (string, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, n); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// remoteSha256 hashes the first n bytes of path on the remote host. It prefers sha256sum on the
+// remote so only the digest crosses the link, and falls back to reading the file over SFTP.
+func (r *RemoteAppDeploymentAgent) remoteSha256(ctx context.Context, sftpClient *sftp.Client, path string, n int64) (string, error) {
+	script := fmt.Sprintf("head -c %d %s | sha256sum", n, ShellQuote(path))
+	result, err := r.RunCommandWithResult(ctx, "sh", []string{"-c", ShellQuote(script)})
+	if err == nil {
+		if sum, _, ok := strings.Cut(strings.TrimSpace(result.Stdout), " "); ok && len(sum) == sha256.Size*2 {
+			return sum, nil
+		}
+	}
+
+	f, err := sftpClient.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, n); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NewTerminalProgressBar returns a ProgressFunc that redraws a single progress line on w.
+func NewTerminalProgressBar(w io.Writer, label string) ProgressFunc {
+	const width = 30
+	return func(p TransferProgress) {
+		pct := 1.0
+		if p.Total > 0 {
+			pct = float64(p.Transferred) / float64(p.Total)
+		}
+		filled := int(pct * width)
+		bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+		fmt.Fprintf(w, "\r%s [%s] %3.0f%% %s/%s %s/s ETA %s   ",
+			label, bar, pct*100, formatBytes(p.Transferred), formatBytes(p.Total),
+			formatBytes(int64(p.Rate)), p.ETA.Round(time.Second))
+		if p.Done {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// uploadOptions returns the options Upload uses for single files.
+func (r *RemoteAppDeploymentAgent) uploadOptions(src string) UploadOptions {
+	opts := UploadOptions{Resume: true, Verify: true}
+	if r.ShowProgress {
+		opts.Progress = NewTerminalProgressBar(os.Stderr, filepath.Base(src))
+	}
+	return opts
+}
@@ -1,25 +1,42 @@
 package ssh
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"net"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/babbage88/goph/v2"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+	sshagent "golang.org/x/crypto/ssh/agent"
 )
 
 const validateUserUidBase string = "validate-user"
 
 type RemoteAppDeploymentAgent struct {
 	SshClient           *goph.Client      `json:"-"`
+	Hostname            string            `json:"hostname"`
+	User                string            `json:"user"`
 	SourceUtilsDir      string            `json:"srcUtilsDir"`
 	DestinationUtilsDir string            `json:"dstUtilsDir"`
 	EnvVars             map[string]string `json:"envVars"`
 	RemoteCommand       *goph.Cmd         `json:"remoteCommands"`
+	// CommandTimeout bounds every remote command run through the agent. Zero means no timeout.
+	CommandTimeout time.Duration `json:"commandTimeout"`
+	// SudoPassword supplies the password for hosts without passwordless sudo. It is only called
+	// once per agent and the value is never logged.
+	SudoPassword SudoPasswordFunc `json:"-"`
+	// ShowProgress draws a progress bar on stderr for single-file uploads.
+	ShowProgress bool `json:"showProgress"`
+	sudo         sudoState
+	// jump is the bastion connection the client is tunnelled through, closed along with it.
+	jump *RemoteAppDeploymentAgent
 }
 
 func VerifyHost(host string, remote net.Addr, key ssh.PublicKey) error {
@@ -54,32 +71,67 @@ func VerifyHost(host string, remote net.Addr, key ssh.PublicKey) error {
 	return goph.AddKnownHost(host, remote, key, "")
 }
 
-func initializeSshClient(host string, user string, port uint, sshKeyPath string, sshPassphrase string, agent bool) (*goph.Client, error) {
-	var auth goph.Auth
-	var err error
-	if agent || goph.HasAgent() {
+// sshAuth offers the key at sshKeyPath, with its certificate when there is one, followed by the
+// ssh agent's keys when the agent is requested or available. The key goes first so a configured
+// key or certificate is used even when the agent holds other keys, and both are offered from one
+// callback because the ssh client tries each auth method only once. Without a key path only the
+// agent is used.
+//
+// The agent is only needed while authenticating, so callers call release once the connection is
+// established or has failed, which closes the agent socket opened for the key and agent callback.
+func sshAuth(sshKeyPath string, sshPassphrase string, agent bool) (auth goph.Auth, release func(), err error) {
+	release = func() {}
+	if !agent && !goph.HasAgent() {
+		auth, err = KeyAuth(sshKeyPath, sshPassphrase)
+		return auth, release, err
+	}
+	if sshKeyPath == "" {
+		auth, err = goph.UseAgent()
+		return auth, release, err
+	}
+
+	signer, err := keySigner(sshKeyPath, sshPassphrase)
+	if err != nil {
+		slog.Warn("unable to load ssh key, using the ssh agent only", slog.String("key", sshKeyPath), slog.String("error", err.Error()))
 		auth, err = goph.UseAgent()
+		return auth, release, err
+	}
+	conn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+	if err != nil {
+		return nil, release, fmt.Errorf("error connecting to ssh agent: %w", err)
+	}
+	agentClient := sshagent.NewClient(conn)
+	auth = goph.Auth{ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		signers := []ssh.Signer{signer}
+		agentSigners, err := agentClient.Signers()
 		if err != nil {
-			log.Fatal(err)
+			return signers, nil
 		}
+		return append(signers, agentSigners...), nil
+	})}
+	return auth, func() { conn.Close() }, nil
+}
 
-	} else {
-		auth, err = goph.Key(sshKeyPath, sshPassphrase)
-	}
+func initializeSshClient(host string, user string, port uint, sshKeyPath string, sshPassphrase string, agent bool) (*goph.Client, error) {
+	return initializeSshClientWithCallback(host, user, port, sshKeyPath, sshPassphrase, agent, VerifyHost)
+}
 
+func initializeSshClientWithCallback(host string, user string, port uint, sshKeyPath string, sshPassphrase string, agent bool, callback ssh.HostKeyCallback) (*goph.Client, error) {
+	auth, release, err := sshAuth(sshKeyPath, sshPassphrase, agent)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	defer release()
 
 	client, err := goph.NewConn(&goph.Config{
 		User:     user,
 		Addr:     host,
 		Port:     port,
 		Auth:     auth,
-		Callback: VerifyHost,
+		Callback: callback,
 	})
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	// Defer closing the network connection.
 	return client, err
@@ -99,6 +151,8 @@ func NewRemoteAppDeploymentAgentWithPassword(hostname, sshUser, srcUtilsPath, ds
 	}
 	remoteDeployAgent := RemoteAppDeploymentAgent{
 		SshClient:           sshClient,
+		Hostname:            hostname,
+		User:                sshUser,
 		SourceUtilsDir:      srcUtilsPath,
 		DestinationUtilsDir: dstUtilsPath,
 		EnvVars:             envVars,
@@ -116,6 +170,8 @@ func NewRemoteAppDeploymentAgentWithSshKey(hostname, sshUser, srcUtilsPath, dstU
 
 	remoteDeployAgent := RemoteAppDeploymentAgent{
 		SshClient:           sshClient,
+		Hostname:            hostname,
+		User:                sshUser,
 		SourceUtilsDir:      srcUtilsPath,
 		DestinationUtilsDir: dstUtilsPath,
 		EnvVars:             envVars,
@@ -124,6 +180,21 @@ func NewRemoteAppDeploymentAgentWithSshKey(hostname, sshUser, srcUtilsPath, dstU
 	return &remoteDeployAgent, nil
 }
 
+// NewRemoteAppDeploymentAgentForNewHost connects to a host that was just created, such as a new
+// container, trusting its host key with ReplaceHostKey instead of prompting. A key known_hosts
+// still has for a previous host at the same address is replaced.
+func NewRemoteAppDeploymentAgentForNewHost(hostname, sshUser, sshKey, sshPassphrase string, agent bool, port uint) (*RemoteAppDeploymentAgent, error) {
+	sshClient, err := initializeSshClientWithCallback(hostname, sshUser, port, sshKey, sshPassphrase, agent, ReplaceHostKey)
+	if err != nil {
+		return nil, SshErrorWrapper(500, err, "failed to initialize ssh client")
+	}
+	return &RemoteAppDeploymentAgent{
+		SshClient: sshClient,
+		Hostname:  hostname,
+		User:      sshUser,
+	}, nil
+}
+
 func InitializeRemoteSshAgent(hostname, sshUser, sshKey, sshPassphrase string, envVars map[string]string, agent bool, port uint) (*RemoteAppDeploymentAgent, error) {
 	sshClient, err := initializeSshClient(hostname, sshUser, port, sshKey, sshPassphrase, agent)
 	if err != nil {
@@ -133,6 +204,8 @@ func InitializeRemoteSshAgent(hostname, sshUser, sshKey, sshPassphrase string, e
 
 	remoteDeployAgent := RemoteAppDeploymentAgent{
 		SshClient: sshClient,
+		Hostname:  hostname,
+		User:      sshUser,
 		EnvVars:   envVars,
 	}
 
@@ -148,7 +221,12 @@ func (r *RemoteAppDeploymentAgent) CopyUtilsToRemoteHost() error {
 	return nil
 }
 
+// Upload copies src to dst. Regular files go through the chunked, resumable and checksum verified
+// UploadFile; directories are uploaded recursively by goph.
 func (r *RemoteAppDeploymentAgent) Upload(src, dst string) error {
+	if stat, statErr := os.Stat(src); statErr == nil && stat.Mode().IsRegular() {
+		return r.UploadFile(context.Background(), src, dst, r.uploadOptions(src))
+	}
 	err := r.SshClient.Upload(src, dst)
 	if err != nil {
 		log.Printf("Error uploading files to remote  src: %s dst: %s err: %s\n", src, dst, err.Error())
@@ -158,10 +236,9 @@ func (r *RemoteAppDeploymentAgent) Upload(src, dst string) error {
 }
 
 func (r *RemoteAppDeploymentAgent) UploadBin(src, dst string) error {
-	err := r.SshClient.Upload(src, dst)
+	err := r.Upload(src, dst)
 	if err != nil {
-		log.Printf("Error uploading files to remote  src: %s dst: %s err: %s\n", src, dst, err.Error())
-		return SftpErrorWrapper(501, err, "error preforming upload over sftp")
+		return err
 	}
 	r.RunCommand("chmod", []string{"+x", dst})
 	return nil
@@ -209,18 +286,17 @@ func (r *RemoteAppDeploymentAgent) WriteBytesSftp(destinationPath string, data [
 }
 
 func (r *RemoteAppDeploymentAgent) RunCommand(remoteCmd string, args []string) error {
-	cmd, err := r.SshClient.Command(remoteCmd, args...)
-	// You can set env vars, but the server must be configured to `AcceptEnv line`.
-	cmd.Env = r.GetEnvarSlice()
+	return r.RunCommandContext(context.Background(), remoteCmd, args)
+}
 
-	log.Printf("Executing remote command cmd: %s args: %v\n", remoteCmd, args)
-	if err != nil {
-		slog.Error("error initializing goph Command", "error", err.Error())
-		return err
-	}
+// RunCommandContext runs remoteCmd on the remote host, killing the remote session if ctx is
+// cancelled or the agent's CommandTimeout elapses before the command exits. When the command
+// exits non-zero the returned error carries its stdout and stderr.
+func (r *RemoteAppDeploymentAgent) RunCommandContext(ctx context.Context, remoteCmd string, args []string) error {
+	log.Printf("Executing remote command cmd: %s args: %v\n", r.redact(remoteCmd), r.redactSlice(args))
 
 	// Only run ONCE
-	err = cmd.Run()
+	_, err := r.RunCommandWithResult(ctx, remoteCmd, args)
 	if err != nil {
 		slog.Error("error Running goph Command", "error", err.Error())
 	}
@@ -228,6 +304,16 @@ func (r *RemoteAppDeploymentAgent) RunCommand(remoteCmd string, args []string) e
 }
 
 func (r *RemoteAppDeploymentAgent) RunCommandAndCaptureOutput(remoteCmd string, args []string) ([]byte, error) {
+	return r.RunCommandAndCaptureOutputContext(context.Background(), remoteCmd, args)
+}
+
+// RunCommandAndCaptureOutputContext is RunCommandAndCaptureOutput with cancellation and timeout
+// handling identical to RunCommandContext. Whatever output was produced is returned alongside
+// any error.
+func (r *RemoteAppDeploymentAgent) RunCommandAndCaptureOutputContext(ctx context.Context, remoteCmd string, args []string) ([]byte, error) {
+	ctx, cancel := r.commandContext(ctx)
+	defer cancel()
+
 	cmd, err := r.SshClient.Command(remoteCmd, args...)
 	if err != nil {
 		return nil, err
@@ -236,14 +322,54 @@ func (r *RemoteAppDeploymentAgent) RunCommandAndCaptureOutput(remoteCmd string,
 	// You can set env vars, but the server must be configured to `AcceptEnv line`.
 	cmd.Env = r.GetEnvarSlice()
 
-	combinedOutput, err := cmd.CombinedOutput()
+	var combinedOutput []byte
+	err = r.runWithContext(ctx, cmd, remoteCmd, args, func() error {
+		var runErr error
+		combinedOutput, runErr = cmd.CombinedOutput()
+		return runErr
+	})
 	if err != nil {
 		fmt.Println("Error:", err)
-		return nil, err
 	}
 	return combinedOutput, err
 }
 
+// commandContext applies the agent's CommandTimeout, if any, on top of ctx.
+func (r *RemoteAppDeploymentAgent) commandContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.CommandTimeout > 0 {
+		return context.WithTimeout(ctx, r.CommandTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// runWithContext executes run and waits for it to finish or for ctx to be done. On cancellation
+// the remote process is sent SIGKILL and the session is closed so run unblocks, and run is waited
+// for so the caller can read its output buffers safely.
+func (r *RemoteAppDeploymentAgent) runWithContext(ctx context.Context, cmd *goph.Cmd, remoteCmd string, args []string, run func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- run()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if cmd.Session != nil {
+			_ = cmd.Signal(ssh.SIGKILL)
+			_ = cmd.Close()
+		}
+		<-done
+		commandLine := strings.TrimSpace(remoteCmd + " " + strings.Join(args, " "))
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			slog.Error("remote command timed out", slog.String("host", r.Hostname), slog.String("cmd", commandLine), slog.Duration("timeout", r.CommandTimeout))
+			return RemoteCommandTimeoutWrapper(r.Hostname, commandLine, r.CommandTimeout, ctx.Err())
+		}
+		slog.Warn("remote command cancelled", slog.String("host", r.Hostname), slog.String("cmd", commandLine))
+		return fmt.Errorf("remote command %q on %s cancelled: %w", commandLine, r.Hostname, ctx.Err())
+	}
+}
+
 func (r *RemoteAppDeploymentAgent) GetEnvarSlice() []string {
 	argEnvars := make([]string, len(r.EnvVars))
 	for k, v := range r.EnvVars {
@@ -1,5 +1,11 @@
 package ssh
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 type SshInitializationError struct {
 	Message string `json:"message"` // Human readable message for clients
 	Code    int    `json:"-"`       // HTTP Status code. We use `-` to skip json marshaling.
@@ -103,3 +109,71 @@ func (err SftpTransferError) Error() string {
 	}
 	return err.Message
 }
+
+// RemoteCommandTimeoutError is returned when a remote command does not finish within the
+// agent's CommandTimeout. The remote session is killed before the error is returned.
+type RemoteCommandTimeoutError struct {
+	Message string        `json:"message"` // Human readable message for clients
+	Code    int           `json:"-"`       // HTTP Status code. We use `-` to skip json marshaling.
+	Err     error         `json:"-"`       // The original error. Same reason as above.
+	Host    string        `json:"host"`
+	Command string        `json:"command"`
+	Timeout time.Duration `json:"timeout"`
+}
+
+func RemoteCommandTimeoutWrapper(host, command string, timeout time.Duration, err error) error {
+	return RemoteCommandTimeoutError{
+		Message: fmt.Sprintf("remote command %q on %s timed out after %s", command, host, timeout),
+		Code:    408,
+		Err:     err,
+		Host:    host,
+		Command: command,
+		Timeout: timeout,
+	}
+}
+
+// Implements the errors.Unwrap interface
+func (err RemoteCommandTimeoutError) Unwrap() error {
+	return err.Err
+}
+
+func (err RemoteCommandTimeoutError) Error() string {
+	return err.Message
+}
+
+// RemoteCommandError is returned when a remote command exits with a non-zero status. It keeps the
+// full CommandResult so callers can surface the command's own output.
+type RemoteCommandError struct {
+	Message string         `json:"message"` // Human readable message for clients
+	Code    int            `json:"-"`       // HTTP Status code. We use `-` to skip json marshaling.
+	Err     error          `json:"-"`       // The original error. Same reason as above.
+	Result  *CommandResult `json:"result"`
+}
+
+func RemoteCommandErrorWrapper(result *CommandResult, err error) error {
+	return RemoteCommandError{
+		Message: fmt.Sprintf("remote command %q on %s exited with status %d", result.Command, result.Host, result.ExitCode),
+		Code:    502,
+		Err:     err,
+		Result:  result,
+	}
+}
+
+// Implements the errors.Unwrap interface
+func (err RemoteCommandError) Unwrap() error {
+	return err.Err
+}
+
+func (err RemoteCommandError) Error() string {
+	if err.Result == nil {
+		return err.Message
+	}
+	output := strings.TrimSpace(err.Result.Stderr)
+	if output == "" {
+		output = strings.TrimSpace(err.Result.Stdout)
+	}
+	if output == "" {
+		return err.Message
+	}
+	return fmt.Sprintf("%s:\n%s", err.Message, output)
+}
@@ -51,3 +51,11 @@ func askIsHostTrusted(host string, key ssh.PublicKey) bool {
 
 	return strings.ToLower(strings.TrimSpace(a)) == "yes"
 }
+
+// ShellQuote wraps s in single quotes so a POSIX shell treats it as one literal word.
+func ShellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
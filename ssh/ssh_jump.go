@@ -0,0 +1,61 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/babbage88/goph/v2"
+	"golang.org/x/crypto/ssh"
+)
+
+// NewRemoteAppDeploymentAgentViaJumpHost connects to hostname through an already connected jump
+// host, like ssh -J. The returned agent owns jump and closes it in Close.
+func NewRemoteAppDeploymentAgentViaJumpHost(jump *RemoteAppDeploymentAgent, hostname, sshUser, sshKey, sshPassphrase string, envVars map[string]string, agent bool, port uint) (*RemoteAppDeploymentAgent, error) {
+	auth, release, err := sshAuth(sshKey, sshPassphrase, agent)
+	if err != nil {
+		return nil, SshErrorWrapper(500, err, "failed to initialize ssh client")
+	}
+	defer release()
+
+	config := &goph.Config{
+		User:     sshUser,
+		Addr:     hostname,
+		Port:     port,
+		Auth:     auth,
+		Callback: VerifyHost,
+	}
+	addr := net.JoinHostPort(hostname, strconv.FormatUint(uint64(port), 10))
+	conn, err := jump.SshClient.Dial("tcp", addr)
+	if err != nil {
+		return nil, SshErrorWrapper(500, err, fmt.Sprintf("failed to reach %s through jump host %s", addr, jump.Hostname))
+	}
+
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            sshUser,
+		Auth:            auth,
+		HostKeyCallback: VerifyHost,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, SshErrorWrapper(500, err, "failed to initialize ssh client")
+	}
+
+	return &RemoteAppDeploymentAgent{
+		SshClient: &goph.Client{Client: ssh.NewClient(clientConn, chans, reqs), Config: config},
+		Hostname:  hostname,
+		User:      sshUser,
+		EnvVars:   envVars,
+		jump:      jump,
+	}, nil
+}
+
+// Close closes the ssh connection and, for agents created through a jump host, the jump host
+// connection as well.
+func (r *RemoteAppDeploymentAgent) Close() error {
+	err := r.SshClient.Close()
+	if r.jump != nil {
+		r.jump.Close()
+	}
+	return err
+}
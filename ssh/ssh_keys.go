@@ -0,0 +1,199 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"golang.org/x/crypto/ssh"
+)
+
+const certificateSuffix string = "-cert.pub"
+
+// defaultCertExtensions mirrors the extensions ssh-keygen grants user certificates by default.
+var defaultCertExtensions = map[string]string{
+	"permit-X11-forwarding":   "",
+	"permit-agent-forwarding": "",
+	"permit-port-forwarding":  "",
+	"permit-pty":              "",
+	"permit-user-rc":          "",
+}
+
+// CertOptions describes the user certificate issued by SignUserCertificate.
+type CertOptions struct {
+	KeyId      string    `json:"keyId"`
+	Principals []string  `json:"principals"`
+	ValidFrom  time.Time `json:"validFrom"`
+	ValidTo    time.Time `json:"validTo"` // zero means forever
+}
+
+// CertificatePathForKey returns the OpenSSH certificate path paired with a private key file.
+func CertificatePathForKey(keyPath string) string {
+	return keyPath + certificateSuffix
+}
+
+// KeyAuth builds public key auth from a private key file. If an OpenSSH user certificate exists
+// next to the key (<key>-cert.pub) the certificate is presented instead of the bare key.
+func KeyAuth(keyPath, passphrase string) (goph.Auth, error) {
+	signer, err := keySigner(keyPath, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return goph.Auth{ssh.PublicKeys(signer)}, nil
+}
+
+// keySigner loads the private key at keyPath, paired with its certificate when one exists.
+func keySigner(keyPath, passphrase string) (ssh.Signer, error) {
+	signer, err := loadSigner(keyPath, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	certPath := CertificatePathForKey(keyPath)
+	if _, err := os.Stat(certPath); err != nil {
+		return signer, nil
+	}
+	cert, err := loadCertificate(certPath)
+	if err != nil {
+		return nil, err
+	}
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("certificate %s does not match key %s: %w", certPath, keyPath, err)
+	}
+	return certSigner, nil
+}
+
+func loadSigner(keyPath, passphrase string) (ssh.Signer, error) {
+	pemBytes, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase != "" {
+		return ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(passphrase))
+	}
+	return ssh.ParsePrivateKey(pemBytes)
+}
+
+func loadCertificate(certPath string) (*ssh.Certificate, error) {
+	certBytes, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(certBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate %s: %w", certPath, err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ssh certificate", certPath)
+	}
+	return cert, nil
+}
+
+// KeyPair is a freshly generated ed25519 key in OpenSSH formats.
+type KeyPair struct {
+	PrivateKeyPEM []byte        `json:"-"`
+	PublicKey     ssh.PublicKey `json:"-"`
+	AuthorizedKey string        `json:"authorizedKey"` // single line for authorized_keys or SshPublicKeys
+}
+
+// GenerateEd25519KeyPair creates a new ed25519 key, encrypting the private key when passphrase is set.
+func GenerateEd25519KeyPair(comment, passphrase string) (*KeyPair, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var block *pem.Block
+	if passphrase != "" {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, comment, []byte(passphrase))
+	} else {
+		block, err = ssh.MarshalPrivateKey(priv, comment)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyPair{
+		PrivateKeyPEM: pem.EncodeToMemory(block),
+		PublicKey:     sshPub,
+		AuthorizedKey: authorizedKeyLine(sshPub, comment),
+	}, nil
+}
+
+// WriteFiles writes the private key to path (0600) and the public key to path.pub (0644).
+func (k *KeyPair) WriteFiles(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, k.PrivateKeyPEM, 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(path+".pub", []byte(k.AuthorizedKey+"\n"), 0o644)
+}
+
+// SignUserCertificate signs pub with the CA private key at caKeyPath and returns the certificate
+// in authorized_keys format, ready to be written to <key>-cert.pub.
+func SignUserCertificate(caKeyPath, caPassphrase string, pub ssh.PublicKey, opts CertOptions) ([]byte, error) {
+	caSigner, err := loadSigner(caKeyPath, caPassphrase)
+	if err != nil {
+		return nil, fmt.Errorf("error loading CA key %s: %w", caKeyPath, err)
+	}
+
+	validFrom := opts.ValidFrom
+	if validFrom.IsZero() {
+		validFrom = time.Now().Add(-5 * time.Minute)
+	}
+	validBefore := uint64(ssh.CertTimeInfinity)
+	if !opts.ValidTo.IsZero() {
+		if !opts.ValidTo.After(validFrom) {
+			return nil, fmt.Errorf("certificate validity window ends before it starts")
+		}
+		validBefore = uint64(opts.ValidTo.Unix())
+	}
+
+	serial := make([]byte, 8)
+	if _, err := rand.Read(serial); err != nil {
+		return nil, err
+	}
+	var serialNum uint64
+	for _, b := range serial {
+		serialNum = serialNum<<8 | uint64(b)
+	}
+
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          serialNum,
+		CertType:        ssh.UserCert,
+		KeyId:           opts.KeyId,
+		ValidPrincipals: opts.Principals,
+		ValidAfter:      uint64(validFrom.Unix()),
+		ValidBefore:     validBefore,
+		Permissions: ssh.Permissions{
+			Extensions: defaultCertExtensions,
+		},
+	}
+	if err := cert.SignCert(rand.Reader, caSigner); err != nil {
+		return nil, fmt.Errorf("error signing certificate: %w", err)
+	}
+	return ssh.MarshalAuthorizedKey(cert), nil
+}
+
+func authorizedKeyLine(pub ssh.PublicKey, comment string) string {
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if comment != "" {
+		line += " " + comment
+	}
+	return line
+}
@@ -0,0 +1,96 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// CommandResult is the outcome of a single command executed on a remote host.
+type CommandResult struct {
+	Host     string        `json:"host" yaml:"host"`
+	User     string        `json:"user" yaml:"user"`
+	Command  string        `json:"command" yaml:"command"`
+	ExitCode int           `json:"exitCode" yaml:"exitCode"` // -1 when the command never reported an exit status
+	Stdout   string        `json:"stdout" yaml:"stdout"`
+	Stderr   string        `json:"stderr" yaml:"stderr"`
+	Duration time.Duration `json:"duration" yaml:"duration"`
+	Err      error         `json:"-" yaml:"-"`
+}
+
+func (c *CommandResult) Success() bool {
+	return c.Err == nil && c.ExitCode == 0
+}
+
+// Error returns the error message of a failed command, or an empty string on success.
+func (c *CommandResult) Error() string {
+	if c.Err == nil {
+		return ""
+	}
+	return c.Err.Error()
+}
+
+// RunCommandWithResult runs remoteCmd and returns its exit status with stdout and stderr captured
+// separately. A non-nil result is always returned, even when the command fails or times out.
+func (r *RemoteAppDeploymentAgent) RunCommandWithResult(ctx context.Context, remoteCmd string, args []string) (*CommandResult, error) {
+	return r.runCommandWithResult(ctx, remoteCmd, args, nil)
+}
+
+// RunCommandWithStdin is RunCommandWithResult with stdin piped into the remote command.
+func (r *RemoteAppDeploymentAgent) RunCommandWithStdin(ctx context.Context, remoteCmd string, args []string, stdin io.Reader) (*CommandResult, error) {
+	return r.runCommandWithResult(ctx, remoteCmd, args, stdin)
+}
+
+// runCommandWithResult is RunCommandWithResult with an optional reader wired to the remote
+// command's stdin.
+func (r *RemoteAppDeploymentAgent) runCommandWithResult(ctx context.Context, remoteCmd string, args []string, stdin io.Reader) (*CommandResult, error) {
+	result := &CommandResult{
+		Host:     r.Hostname,
+		User:     r.User,
+		Command:  strings.TrimSpace(remoteCmd + " " + strings.Join(args, " ")),
+		ExitCode: -1,
+	}
+
+	ctx, cancel := r.commandContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	cmd, err := r.SshClient.Command(remoteCmd, args...)
+	if err != nil {
+		result.Err = err
+		return result, err
+	}
+	// You can set env vars, but the server must be configured to `AcceptEnv line`.
+	cmd.Env = r.GetEnvarSlice()
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+
+	err = r.runWithContext(ctx, cmd, remoteCmd, args, cmd.Run)
+	result.Stdout = r.redact(stdout.String())
+	result.Stderr = r.redact(stderr.String())
+
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		result.ExitCode = 0
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitStatus()
+		err = RemoteCommandErrorWrapper(result, err)
+	}
+	result.Err = err
+	return result, err
+}
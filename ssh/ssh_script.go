@@ -0,0 +1,86 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ScriptOptions controls how RunScript executes a local script on the remote host.
+type ScriptOptions struct {
+	Sudo  bool      // run the script through sudo
+	Stdin io.Reader // optional data piped into the script
+}
+
+// RunScript uploads the local script at localPath to a temporary file on the remote host, runs it
+// with args and removes it again. The script's #! line picks the interpreter (sh when there is
+// none), so it works on hosts that mount /tmp noexec. Args are shell-quoted.
+func (r *RemoteAppDeploymentAgent) RunScript(ctx context.Context, localPath string, args []string, opts ScriptOptions) (*CommandResult, error) {
+	script, err := os.ReadFile(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading script: %w", err)
+	}
+
+	tmp, err := r.RunCommandWithResult(ctx, "mktemp", []string{"/tmp/infractl-script.XXXXXX"})
+	if err != nil {
+		return tmp, fmt.Errorf("error creating remote temp file: %w", err)
+	}
+	remotePath := strings.TrimSpace(tmp.Stdout)
+
+	sftpClient, err := r.GetSftpClient()
+	if err != nil {
+		return nil, err
+	}
+	defer sftpClient.Close()
+	defer sftpClient.Remove(remotePath)
+
+	f, err := sftpClient.OpenFile(remotePath, os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return nil, SftpFileCreationErrorWrapper(504, err, "error opening remote script")
+	}
+	_, err = f.Write(script)
+	f.Close()
+	if err != nil {
+		return nil, SftpFileCreationErrorWrapper(504, err, "error writing remote script")
+	}
+	if err := sftpClient.Chmod(remotePath, 0o700); err != nil {
+		return nil, SftpErrorWrapper(501, err, "error setting remote script mode")
+	}
+
+	interpreter := scriptInterpreter(script)
+	cmdArgs := append(interpreter[1:], ShellQuote(remotePath))
+	for _, arg := range args {
+		cmdArgs = append(cmdArgs, ShellQuote(arg))
+	}
+
+	var result *CommandResult
+	if opts.Sudo {
+		result, err = r.RunSudoCommandWithStdin(ctx, interpreter[0], cmdArgs, opts.Stdin)
+	} else {
+		result, err = r.RunCommandWithStdin(ctx, interpreter[0], cmdArgs, opts.Stdin)
+	}
+	result.Command = strings.TrimSpace(filepath.Base(localPath) + " " + strings.Join(args, " "))
+	return result, err
+}
+
+// scriptInterpreter returns the interpreter and its argument from the script's #! line, or sh.
+func scriptInterpreter(script []byte) []string {
+	line, _, _ := bufio.NewReader(bytes.NewReader(script)).ReadLine()
+	if !bytes.HasPrefix(line, []byte("#!")) {
+		return []string{"sh"}
+	}
+	// The kernel passes everything after the interpreter as a single argument.
+	interpreter, arg, _ := strings.Cut(strings.TrimSpace(string(line[2:])), " ")
+	if interpreter == "" {
+		return []string{"sh"}
+	}
+	if arg = strings.TrimSpace(arg); arg != "" {
+		return []string{interpreter, ShellQuote(arg)}
+	}
+	return []string{interpreter}
+}
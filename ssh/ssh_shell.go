@@ -0,0 +1,97 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+const defaultShellTerm string = "xterm-256color"
+
+// Shell starts an interactive session on the remote host with a PTY attached to the local
+// terminal. The local terminal is put into raw mode for the duration of the session, window
+// resizes are forwarded, and the terminal is restored on exit. If command is non-empty it is run
+// inside the PTY instead of the login shell.
+func (r *RemoteAppDeploymentAgent) Shell(ctx context.Context, command []string) error {
+	session, err := r.SshClient.NewSession()
+	if err != nil {
+		return SshErrorWrapper(500, err, "failed to open ssh session")
+	}
+	defer session.Close()
+
+	stdinFd := int(os.Stdin.Fd())
+	stdoutFd := int(os.Stdout.Fd())
+	if !term.IsTerminal(stdinFd) {
+		return fmt.Errorf("an interactive shell requires stdin to be a terminal")
+	}
+
+	width, height, err := term.GetSize(stdoutFd)
+	if err != nil {
+		width, height = 80, 24
+	}
+	termType := os.Getenv("TERM")
+	if termType == "" {
+		termType = defaultShellTerm
+	}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty(termType, height, width, modes); err != nil {
+		return SshErrorWrapper(500, err, "failed to request pty")
+	}
+
+	oldState, err := term.MakeRaw(stdinFd)
+	if err != nil {
+		return fmt.Errorf("error putting terminal into raw mode: %w", err)
+	}
+	defer term.Restore(stdinFd, oldState)
+
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	resize := make(chan os.Signal, 1)
+	signal.Notify(resize, syscall.SIGWINCH)
+	// Closing the channel once no more signals are delivered ends the resize goroutine.
+	defer func() {
+		signal.Stop(resize)
+		close(resize)
+	}()
+	go func() {
+		for range resize {
+			if w, h, err := term.GetSize(stdoutFd); err == nil {
+				session.WindowChange(h, w)
+			}
+		}
+	}()
+
+	if len(command) > 0 {
+		err = session.Start(strings.Join(command, " "))
+	} else {
+		err = session.Shell()
+	}
+	if err != nil {
+		return SshErrorWrapper(500, err, "failed to start remote shell")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		session.Close()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,224 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+const (
+	sudoCmd         string = "sudo"
+	sudoNonInteract string = "-n"
+	sudoStdinFlag   string = "-S"
+	sudoPromptFlag  string = "-p"
+	sudoEmptyPrompt string = "''"
+	redactedValue   string = "********"
+)
+
+// SudoPasswordFunc returns the sudo password for a remote host. It is only consulted when
+// `sudo -n true` fails on that host.
+type SudoPasswordFunc func() (string, error)
+
+type sudoState struct {
+	mu       sync.Mutex
+	checked  bool
+	noPasswd bool
+	password string
+	// pwMu also guards password, since redact reads it from commands run while mu is held.
+	pwMu sync.RWMutex
+}
+
+// getPassword returns the cached sudo password, safe to call whether or not mu is held.
+func (s *sudoState) getPassword() string {
+	s.pwMu.RLock()
+	defer s.pwMu.RUnlock()
+	return s.password
+}
+
+// setPassword caches the sudo password. Callers hold mu.
+func (s *sudoState) setPassword(password string) {
+	s.pwMu.Lock()
+	defer s.pwMu.Unlock()
+	s.password = password
+}
+
+// StaticSudoPassword returns a SudoPasswordFunc for a password read from config or the environment.
+func StaticSudoPassword(password string) SudoPasswordFunc {
+	return func() (string, error) {
+		if password == "" {
+			return "", fmt.Errorf("sudo password is empty")
+		}
+		return password, nil
+	}
+}
+
+// CommandSudoPassword runs a local command (e.g. `pass show infra/sudo`) and uses the first line
+// of its output as the sudo password, so the password can live in a secret store.
+func CommandSudoPassword(command string) SudoPasswordFunc {
+	return func() (string, error) {
+		out, err := exec.Command("sh", "-c", command).Output()
+		if err != nil {
+			return "", fmt.Errorf("error running sudo password command: %w", err)
+		}
+		password, _, _ := strings.Cut(string(out), "\n")
+		if password == "" {
+			return "", fmt.Errorf("sudo password command returned no output")
+		}
+		return password, nil
+	}
+}
+
+// PromptSudoPassword asks for the sudo password on the terminal the first time it is needed and
+// reuses the answer afterwards, so a single prompt covers every host in a run.
+func PromptSudoPassword() SudoPasswordFunc {
+	var once sync.Once
+	var password string
+	var err error
+	return func() (string, error) {
+		once.Do(func() {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				err = fmt.Errorf("sudo password required but stdin is not a terminal")
+				return
+			}
+			password = askPass("Enter sudo password: ")
+			if password == "" {
+				err = fmt.Errorf("no sudo password entered")
+			}
+		})
+		return password, err
+	}
+}
+
+// FirstSudoPassword tries each source in order and returns the first password found.
+func FirstSudoPassword(sources ...SudoPasswordFunc) SudoPasswordFunc {
+	return func() (string, error) {
+		var lastErr error = fmt.Errorf("no sudo password source configured")
+		for _, source := range sources {
+			if source == nil {
+				continue
+			}
+			password, err := source()
+			if err == nil {
+				return password, nil
+			}
+			lastErr = err
+		}
+		return "", lastErr
+	}
+}
+
+// DetectPasswordlessSudo reports whether `sudo -n true` succeeds on the remote host. The answer is
+// cached for the lifetime of the agent.
+func (r *RemoteAppDeploymentAgent) DetectPasswordlessSudo(ctx context.Context) (bool, error) {
+	r.sudo.mu.Lock()
+	defer r.sudo.mu.Unlock()
+	return r.detectPasswordlessSudoLocked(ctx)
+}
+
+func (r *RemoteAppDeploymentAgent) detectPasswordlessSudoLocked(ctx context.Context) (bool, error) {
+	if r.sudo.checked {
+		return r.sudo.noPasswd, nil
+	}
+
+	result, err := r.RunCommandWithResult(ctx, sudoCmd, []string{sudoNonInteract, "true"})
+	if err != nil && result.ExitCode < 0 {
+		return false, fmt.Errorf("error checking sudo on %s: %w", r.Hostname, err)
+	}
+	r.sudo.checked = true
+	r.sudo.noPasswd = result.ExitCode == 0
+	slog.Debug("detected sudo mode", slog.String("host", r.Hostname), slog.Bool("passwordless", r.sudo.noPasswd))
+	return r.sudo.noPasswd, nil
+}
+
+// sudoArgs returns the sudo invocation for the host and, when a password is required, the
+// password to feed on stdin.
+func (r *RemoteAppDeploymentAgent) sudoArgs(ctx context.Context, remoteCmd string, args []string) ([]string, string, error) {
+	r.sudo.mu.Lock()
+	defer r.sudo.mu.Unlock()
+
+	noPasswd, err := r.detectPasswordlessSudoLocked(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if noPasswd {
+		return append([]string{sudoNonInteract, remoteCmd}, args...), "", nil
+	}
+
+	if r.sudo.password == "" {
+		if r.SudoPassword == nil {
+			return nil, "", fmt.Errorf("sudo on %s requires a password but none was configured", r.Hostname)
+		}
+		password, err := r.SudoPassword()
+		if err != nil {
+			return nil, "", fmt.Errorf("error retrieving sudo password for %s: %w", r.Hostname, err)
+		}
+		r.sudo.setPassword(password)
+	}
+	return append([]string{sudoStdinFlag, sudoPromptFlag, sudoEmptyPrompt, remoteCmd}, args...), r.sudo.password, nil
+}
+
+// RunSudoCommandWithResult runs remoteCmd through sudo, using `sudo -n` where passwordless sudo
+// works and otherwise feeding the configured password to `sudo -S` on stdin.
+func (r *RemoteAppDeploymentAgent) RunSudoCommandWithResult(ctx context.Context, remoteCmd string, args []string) (*CommandResult, error) {
+	return r.RunSudoCommandWithStdin(ctx, remoteCmd, args, nil)
+}
+
+// RunSudoCommandWithStdin is RunSudoCommandWithResult with stdin piped into the remote command.
+// When sudo needs a password it is sent ahead of stdin.
+func (r *RemoteAppDeploymentAgent) RunSudoCommandWithStdin(ctx context.Context, remoteCmd string, args []string, stdin io.Reader) (*CommandResult, error) {
+	sudoArgs, password, err := r.sudoArgs(ctx, remoteCmd, args)
+	if err != nil {
+		return &CommandResult{
+			Host:     r.Hostname,
+			User:     r.User,
+			Command:  strings.TrimSpace(sudoCmd + " " + remoteCmd + " " + strings.Join(args, " ")),
+			ExitCode: -1,
+			Err:      err,
+		}, err
+	}
+
+	if password == "" {
+		return r.runCommandWithResult(ctx, sudoCmd, sudoArgs, stdin)
+	}
+	passwordLine := strings.NewReader(password + "\n")
+	if stdin == nil {
+		return r.runCommandWithResult(ctx, sudoCmd, sudoArgs, passwordLine)
+	}
+	return r.runCommandWithResult(ctx, sudoCmd, sudoArgs, io.MultiReader(passwordLine, stdin))
+}
+
+// RunSudoCommandContext is RunCommandContext for commands that need root.
+func (r *RemoteAppDeploymentAgent) RunSudoCommandContext(ctx context.Context, remoteCmd string, args []string) error {
+	log.Printf("Executing remote command cmd: %s %s args: %v\n", sudoCmd, r.redact(remoteCmd), r.redactSlice(args))
+
+	_, err := r.RunSudoCommandWithResult(ctx, remoteCmd, args)
+	if err != nil {
+		slog.Error("error Running goph Command", "error", err.Error())
+	}
+	return err
+}
+
+// redact masks the sudo password anywhere it appears in s.
+func (r *RemoteAppDeploymentAgent) redact(s string) string {
+	password := r.sudo.getPassword()
+	if password == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, password, redactedValue)
+}
+
+func (r *RemoteAppDeploymentAgent) redactSlice(in []string) []string {
+	out := make([]string, len(in))
+	for i, s := range in {
+		out[i] = r.redact(s)
+	}
+	return out
+}
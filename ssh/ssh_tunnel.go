@@ -0,0 +1,335 @@
+package ssh
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type ForwardKind string
+
+const (
+	LocalForward   ForwardKind = "local"
+	RemoteForward  ForwardKind = "remote"
+	DynamicForward ForwardKind = "dynamic"
+
+	tunnelKeepAliveInterval time.Duration = 15 * time.Second
+	tunnelMaxRetryDelay     time.Duration = 30 * time.Second
+)
+
+// Forward is a single port forward carried by a Tunnel. For local forwards ListenAddr is on this
+// machine and TargetAddr is dialled from the remote host; remote forwards are the reverse.
+// Dynamic forwards run a SOCKS5 proxy on ListenAddr and have no TargetAddr.
+type Forward struct {
+	Kind       ForwardKind `json:"kind"`
+	ListenAddr string      `json:"listenAddr"`
+	TargetAddr string      `json:"targetAddr,omitempty"`
+}
+
+func (f Forward) String() string {
+	if f.Kind == DynamicForward {
+		return fmt.Sprintf("%s socks5://%s", f.Kind, f.ListenAddr)
+	}
+	return fmt.Sprintf("%s %s -> %s", f.Kind, f.ListenAddr, f.TargetAddr)
+}
+
+// ParseForward parses OpenSSH style forward specs: [bind_address:]port:host:hostport for local and
+// remote forwards and [bind_address:]port for dynamic forwards. The bind address defaults to localhost.
+func ParseForward(kind ForwardKind, spec string) (Forward, error) {
+	parts := splitForwardSpec(spec)
+	fwd := Forward{Kind: kind}
+	switch {
+	case kind == DynamicForward && len(parts) == 1:
+		fwd.ListenAddr = net.JoinHostPort("localhost", parts[0])
+	case kind == DynamicForward && len(parts) == 2:
+		fwd.ListenAddr = net.JoinHostPort(parts[0], parts[1])
+	case kind != DynamicForward && len(parts) == 3:
+		fwd.ListenAddr = net.JoinHostPort("localhost", parts[0])
+		fwd.TargetAddr = net.JoinHostPort(parts[1], parts[2])
+	case kind != DynamicForward && len(parts) == 4:
+		fwd.ListenAddr = net.JoinHostPort(parts[0], parts[1])
+		fwd.TargetAddr = net.JoinHostPort(parts[2], parts[3])
+	default:
+		return fwd, fmt.Errorf("invalid %s forward %q", kind, spec)
+	}
+	return fwd, nil
+}
+
+// splitForwardSpec splits on ':' while keeping bracketed IPv6 addresses intact.
+func splitForwardSpec(spec string) []string {
+	var parts []string
+	var cur strings.Builder
+	bracket := false
+	for _, c := range spec {
+		switch {
+		case c == '[':
+			bracket = true
+		case c == ']':
+			bracket = false
+		case c == ':' && !bracket:
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteRune(c)
+		}
+	}
+	return append(parts, cur.String())
+}
+
+// Tunnel keeps a set of forwards open over an SSH connection, reconnecting with backoff whenever
+// the connection drops, until its context is cancelled.
+type Tunnel struct {
+	Connect  func() (*RemoteAppDeploymentAgent, error)
+	Forwards []Forward
+
+	mu     sync.RWMutex
+	client *ssh.Client
+}
+
+func (t *Tunnel) currentClient() (*ssh.Client, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.client == nil {
+		return nil, errors.New("ssh connection is down, reconnecting")
+	}
+	return t.client, nil
+}
+
+func (t *Tunnel) setClient(c *ssh.Client) {
+	t.mu.Lock()
+	t.client = c
+	t.mu.Unlock()
+}
+
+// Run opens the local listeners once, then connects and serves until ctx is done, reconnecting with
+// backoff when the connection drops. It returns the error when the first connection fails.
+func (t *Tunnel) Run(ctx context.Context) error {
+	var listeners []net.Listener
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+
+	for _, fwd := range t.Forwards {
+		if fwd.Kind == RemoteForward {
+			continue
+		}
+		l, err := net.Listen("tcp", fwd.ListenAddr)
+		if err != nil {
+			return fmt.Errorf("error listening on %s: %w", fwd.ListenAddr, err)
+		}
+		listeners = append(listeners, l)
+		go t.serveLocal(l, fwd)
+		slog.Info("Forward listening", slog.String("forward", fwd.String()))
+	}
+
+	// Only reconnect once a connection has worked, so errors that retrying cannot fix, such as a
+	// rejected key or host key, are returned straight away.
+	delay := time.Second
+	everConnected := false
+	for {
+		connected, err := t.runConnection(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if !connected && !everConnected {
+			return err
+		}
+		if connected {
+			everConnected = true
+			delay = time.Second
+		}
+		slog.Warn("ssh tunnel connection lost, reconnecting", slog.String("error", fmt.Sprint(err)), slog.Duration("retryIn", delay))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, tunnelMaxRetryDelay)
+	}
+}
+
+// runConnection connects, registers remote forwards and blocks until the connection closes. It
+// reports whether a connection was established before the error occurred.
+func (t *Tunnel) runConnection(ctx context.Context) (bool, error) {
+	agent, err := t.Connect()
+	if err != nil {
+		return false, err
+	}
+	client := agent.SshClient.Client
+	t.setClient(client)
+	defer t.setClient(nil)
+	defer agent.Close()
+	slog.Info("ssh tunnel connected", slog.String("host", agent.Hostname))
+
+	for _, fwd := range t.Forwards {
+		if fwd.Kind != RemoteForward {
+			continue
+		}
+		l, err := client.Listen("tcp", fwd.ListenAddr)
+		if err != nil {
+			return true, fmt.Errorf("error requesting remote forward %s: %w", fwd.ListenAddr, err)
+		}
+		go t.serveRemote(l, fwd)
+		slog.Info("Forward listening", slog.String("forward", fwd.String()))
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- client.Wait()
+	}()
+
+	ticker := time.NewTicker(tunnelKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case err := <-closed:
+			return true, err
+		case <-ticker.C:
+			if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+				return true, fmt.Errorf("keepalive failed: %w", err)
+			}
+		}
+	}
+}
+
+func (t *Tunnel) serveLocal(l net.Listener, fwd Forward) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			client, err := t.currentClient()
+			if err != nil {
+				slog.Warn("dropping forwarded connection", slog.String("forward", fwd.String()), slog.String("error", err.Error()))
+				return
+			}
+			if fwd.Kind == DynamicForward {
+				serveSocks5(conn, client)
+				return
+			}
+			remote, err := client.Dial("tcp", fwd.TargetAddr)
+			if err != nil {
+				slog.Warn("error dialing forward target", slog.String("target", fwd.TargetAddr), slog.String("error", err.Error()))
+				return
+			}
+			pipe(conn, remote)
+		}()
+	}
+}
+
+func (t *Tunnel) serveRemote(l net.Listener, fwd Forward) {
+	defer l.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			local, err := net.Dial("tcp", fwd.TargetAddr)
+			if err != nil {
+				slog.Warn("error dialing forward target", slog.String("target", fwd.TargetAddr), slog.String("error", err.Error()))
+				return
+			}
+			pipe(conn, local)
+		}()
+	}
+}
+
+func pipe(a, b net.Conn) {
+	defer b.Close()
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// serveSocks5 handles a single no-auth SOCKS5 CONNECT request, dialling the target through client.
+func serveSocks5(conn net.Conn, client *ssh.Client) {
+	buf := make([]byte, 262)
+
+	// Greeting: VER NMETHODS METHODS...
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil || buf[0] != 0x05 {
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:int(buf[1])]); err != nil {
+		return
+	}
+	if _, err := conn.Write([]byte{0x05, 0x00}); err != nil {
+		return
+	}
+
+	// Request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return
+	}
+	if buf[1] != 0x01 {
+		conn.Write([]byte{0x05, 0x07, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+
+	var host string
+	switch buf[3] {
+	case 0x01:
+		if _, err := io.ReadFull(conn, buf[:net.IPv4len]); err != nil {
+			return
+		}
+		host = net.IP(buf[:net.IPv4len]).String()
+	case 0x03:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return
+		}
+		n := int(buf[0])
+		if _, err := io.ReadFull(conn, buf[:n]); err != nil {
+			return
+		}
+		host = string(buf[:n])
+	case 0x04:
+		if _, err := io.ReadFull(conn, buf[:net.IPv6len]); err != nil {
+			return
+		}
+		host = net.IP(buf[:net.IPv6len]).String()
+	default:
+		conn.Write([]byte{0x05, 0x08, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	port := binary.BigEndian.Uint16(buf[:2])
+	target := net.JoinHostPort(host, strconv.Itoa(int(port)))
+
+	remote, err := client.Dial("tcp", target)
+	if err != nil {
+		slog.Warn("socks5 dial failed", slog.String("target", target), slog.String("error", err.Error()))
+		conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	if _, err := conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0}); err != nil {
+		remote.Close()
+		return
+	}
+	pipe(conn, remote)
+}